@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Поддержка форматов патронов Яндекс.Танка: https://yandextank.readthedocs.io/en/latest/tutorial.html#preparing-requests
+
+const (
+	ammoFormatAuto    = `auto`
+	ammoFormatHLC     = `hlc`
+	ammoFormatPhantom = `phantom`
+	ammoFormatURI     = `uri`
+	ammoFormatURIPost = `uripost`
+	ammoFormatHAR     = `har`
+	ammoFormatNginx   = `nginx`
+
+	ammoReaderSize = 64 * 1024
+)
+
+type (
+	ammoParser func(fileName string, rd *bufio.Reader, reqChan chan<- Request)
+)
+
+var (
+	ErrWrongAmmoFormat = errors.New(`Unknown ammo format`)
+
+	ammoParsers = map[string]ammoParser{
+		ammoFormatHLC:     parseAmmoHLC,
+		ammoFormatPhantom: parseAmmoPhantom,
+		ammoFormatURI:     parseAmmoURI,
+		ammoFormatURIPost: parseAmmoURIPost,
+	}
+
+	reAmmoHLCHeader     = regexp.MustCompile(`^\d+ (GET|POST):`)
+	reAmmoPhantomHeader = regexp.MustCompile(`^(\d+)(\s+(.*))?$`)
+	reAmmoURIPostHeader = regexp.MustCompile(`^(\d+)\s+(/\S*)(\s+(.*))?$`)
+	reAmmoURILine       = regexp.MustCompile(`^(/\S*)(\s+(.*))?$`)
+	reAmmoURIHeader     = regexp.MustCompile(`^\[([^:\]]+):\s*(.*)\]$`)
+	reAmmoRequestLine   = regexp.MustCompile(`^([A-Z]+) (\S+) HTTP/`)
+)
+
+// detectAmmoFormat определяет формат по первой непустой строке, не сдвигая позицию чтения
+func detectAmmoFormat(rd *bufio.Reader) (string, error) {
+	head, err := rd.Peek(rd.Size())
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return ``, errors.Wrap(err, `rd.Peek`)
+	}
+
+	withHeaders := false
+	for _, line := range bytes.Split(head, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		// заголовки "[Key: Value]" бывают и в uri, и в uripost формате
+		switch {
+		case line[0] == '[' || line[0] == '#':
+			withHeaders = true
+			continue
+		case line[0] == '/':
+			return ammoFormatURI, nil
+		case line[0] == '{' && !withHeaders:
+			return ammoFormatHAR, nil
+		case reNginxLine.Match(line):
+			return ammoFormatNginx, nil
+		case reAmmoHLCHeader.Match(line):
+			return ammoFormatHLC, nil
+		case reAmmoURIPostHeader.Match(line):
+			return ammoFormatURIPost, nil
+		case reAmmoPhantomHeader.Match(line):
+			return ammoFormatPhantom, nil
+		default:
+			return ``, errors.Wrap(ErrWrongAmmoFormat, fmt.Sprintf(`%.64q`, line))
+		}
+	}
+
+	if withHeaders {
+		return ammoFormatURI, nil
+	}
+	return ``, errors.Wrap(ErrWrongAmmoFormat, `empty ammo`)
+}
+
+// parseAmmoPhantom читает "size [tag]\n" и затем ровно size байт сырого HTTP запроса
+func parseAmmoPhantom(fileName string, rd *bufio.Reader, reqChan chan<- Request) {
+	lineNo := 0
+	for {
+		line, err := readAmmoLine(rd, &lineNo)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			panic(errors.Wrap(err, fmt.Sprintf(`rd.ReadBytes in %s line#%d`, fileName, lineNo)))
+		} else if len(line) == 0 {
+			continue
+		}
+
+		match := reAmmoPhantomHeader.FindSubmatch(line)
+		if len(match) == 0 {
+			panic(errors.Wrap(ErrWrongAmmoFile, fmt.Sprintf(`Wrong block header in %s line#%d: [%s]`, fileName, lineNo, line)))
+		}
+		size, _ := strconv.Atoi(string(match[1]))
+
+		request := Request{
+			LineNo: lineNo,
+			Head:   line,
+			Tag:    match[3],
+		}
+
+		raw := make([]byte, size)
+		if _, err := io.ReadFull(rd, raw); err != nil {
+			panic(errors.Wrap(ErrWrongAmmoFile, fmt.Sprintf(`Truncated request in %s line#%d: %s`, fileName, lineNo, err)))
+		}
+		lineNo += bytes.Count(raw, []byte{'\n'})
+
+		if err := parseRawRequest(raw, &request); err != nil {
+			panic(errors.Wrap(err, fmt.Sprintf(`%s line#%d`, fileName, request.LineNo)))
+		}
+
+		reqChan <- request
+	}
+}
+
+// parseAmmoURI читает строки "/uri [tag]" (GET) и заголовки "[Key: Value]", действующие на все последующие запросы
+func parseAmmoURI(fileName string, rd *bufio.Reader, reqChan chan<- Request) {
+	var headers []Header
+
+	lineNo := 0
+	for {
+		line, err := readAmmoLine(rd, &lineNo)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			panic(errors.Wrap(err, fmt.Sprintf(`rd.ReadBytes in %s line#%d`, fileName, lineNo)))
+		} else if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		if match := reAmmoURIHeader.FindSubmatch(line); len(match) > 0 {
+			headers = setAmmoHeader(headers, match[1], match[2])
+		} else if match := reAmmoURILine.FindSubmatch(line); len(match) > 0 {
+			reqChan <- Request{
+				LineNo:  lineNo,
+				Head:    line,
+				Tag:     match[3],
+				IsGet:   true,
+				URI:     match[1],
+				Headers: headers,
+			}
+		} else {
+			panic(errors.Wrap(ErrWrongAmmoFile, fmt.Sprintf(`Wrong line in %s line#%d: %s`, fileName, lineNo, line)))
+		}
+	}
+}
+
+// parseAmmoURIPost читает "size /uri [tag]\n" и затем ровно size байт тела POST запроса
+func parseAmmoURIPost(fileName string, rd *bufio.Reader, reqChan chan<- Request) {
+	var headers []Header
+
+	lineNo := 0
+	for {
+		line, err := readAmmoLine(rd, &lineNo)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			panic(errors.Wrap(err, fmt.Sprintf(`rd.ReadBytes in %s line#%d`, fileName, lineNo)))
+		} else if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		if match := reAmmoURIHeader.FindSubmatch(line); len(match) > 0 {
+			headers = setAmmoHeader(headers, match[1], match[2])
+			continue
+		}
+
+		match := reAmmoURIPostHeader.FindSubmatch(line)
+		if len(match) == 0 {
+			panic(errors.Wrap(ErrWrongAmmoFile, fmt.Sprintf(`Wrong block header in %s line#%d: [%s]`, fileName, lineNo, line)))
+		}
+		size, _ := strconv.Atoi(string(match[1]))
+
+		request := Request{
+			LineNo:  lineNo,
+			Head:    line,
+			Tag:     match[4],
+			URI:     match[2],
+			Headers: headers,
+		}
+
+		request.Body = make([]byte, size)
+		if _, err := io.ReadFull(rd, request.Body); err != nil {
+			panic(errors.Wrap(ErrWrongAmmoFile, fmt.Sprintf(`Truncated body in %s line#%d: %s`, fileName, lineNo, err)))
+		}
+		lineNo += bytes.Count(request.Body, []byte{'\n'})
+
+		reqChan <- request
+	}
+}
+
+// parseRawRequest разбирает сырой HTTP запрос: строка запроса, заголовки, пустая строка, тело
+func parseRawRequest(raw []byte, request *Request) error {
+	pos := bytes.IndexByte(raw, '\n')
+	if pos < 0 {
+		return errors.Wrap(ErrWrongAmmoFile, `no request line`)
+	}
+
+	match := reAmmoRequestLine.FindSubmatch(bytes.TrimSpace(raw[:pos]))
+	if len(match) == 0 {
+		return errors.Wrap(ErrWrongAmmoFile, fmt.Sprintf(`Wrong query: %s`, bytes.TrimSpace(raw[:pos])))
+	}
+	switch string(match[1]) {
+	case `GET`:
+		request.IsGet = true
+	case `POST`:
+		request.IsGet = false
+	default:
+		return errors.Wrap(ErrWrongAmmoFile, fmt.Sprintf(`Unsupported method %s`, match[1]))
+	}
+	request.URI = match[2]
+	raw = raw[pos+1:]
+
+	for len(raw) > 0 {
+		var line []byte
+		if pos = bytes.IndexByte(raw, '\n'); pos < 0 {
+			line, raw = raw, nil
+		} else {
+			line, raw = raw[:pos], raw[pos+1:]
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			break
+		}
+
+		pos = bytes.IndexByte(line, ':')
+		if pos <= 0 {
+			return errors.Wrap(ErrWrongAmmoFile, fmt.Sprintf(`Wrong header: %s`, line))
+		}
+		request.Headers = append(request.Headers, Header{Key: line[:pos], Value: bytes.TrimSpace(line[pos+1:])})
+	}
+
+	if len(raw) > 0 {
+		request.Body = raw
+	}
+
+	return nil
+}
+
+func readAmmoLine(rd *bufio.Reader, lineNo *int) ([]byte, error) {
+	line, err := rd.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	*lineNo++
+	return bytes.TrimSpace(line), nil
+}
+
+// setAmmoHeader заменяет значение заголовка. Слайс копируется, т.к. старый уже отдан в прошлые запросы
+func setAmmoHeader(headers []Header, key, value []byte) []Header {
+	result := make([]Header, 0, len(headers)+1)
+	for _, header := range headers {
+		if !bytes.EqualFold(header.Key, key) {
+			result = append(result, header)
+		}
+	}
+	return append(result, Header{Key: key, Value: value})
+}
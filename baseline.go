@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Сравнение прогона с сохраненным -report-json (-baseline): новые и исправленные ошибки по номерам строк патронов
+// и статистически значимые изменения задержки по маршрутам (U-тест Манна-Уитни на выборках задержек из отчетов)
+
+const (
+	// baselineAlpha - уровень значимости изменения задержки
+	baselineAlpha = 0.01
+)
+
+var (
+	ErrBaseline = errors.New(`Wrong baseline report`)
+)
+
+type (
+	baselineFailure struct {
+		line  int
+		route string
+		uri   string
+	}
+
+	baselineRoute struct {
+		route              string
+		oldP50, newP50     int64
+		oldP99, newP99     int64
+		pValue             float64
+		slower, faster     bool
+		regressed, onlyNew bool
+	}
+)
+
+func loadBaseline(fileName string) (*runReport, error) {
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, `os.Open`)
+	}
+	defer fd.Close()
+
+	var report runReport
+	if err := json.NewDecoder(fd).Decode(&report); err != nil {
+		return nil, errors.Wrap(ErrBaseline, err.Error())
+	}
+	if len(report.Routes) == 0 {
+		return nil, errors.Wrap(ErrBaseline, `no routes in `+fileName)
+	}
+	return &report, nil
+}
+
+// compareBaseline печатает сравнение с baseline и сообщает о регрессиях: корректности - новые проваленные патроны,
+// производительности - значимый рост задержки маршрута больше чем на -baseline-tolerance по p99
+func compareBaseline(baseline, report *runReport) (correctnessFailed, performanceFailed bool) {
+	fmt.Println("Baseline comparison:")
+	if baseline.Config.AmmoFile != report.Config.AmmoFile || baseline.Config.Phase != report.Config.Phase {
+		fmt.Printf("WARNING: baseline was made with ammo %s phase %s, now ammo %s phase %s\n",
+			baseline.Config.AmmoFile, baseline.Config.Phase, report.Config.AmmoFile, report.Config.Phase)
+	}
+
+	oldFailed, oldComplete := baselineFailures(baseline)
+	newFailed, newComplete := baselineFailures(report)
+	compareFailed := oldComplete && newComplete
+
+	var newlyFailing, fixed []baselineFailure
+	if !compareFailed {
+		// по обрезанному списку ошибок новые и исправленные патроны не отличить от выпавших из списка
+		fmt.Printf("WARNING: baseline has no failed_lines and its failures list is truncated to %d, failed bullets are not compared\n", maxReportFailures)
+		oldFailed, newFailed = nil, nil
+	}
+	for line, failure := range newFailed {
+		if _, ok := oldFailed[line]; !ok {
+			newlyFailing = append(newlyFailing, failure)
+		}
+	}
+	for line, failure := range oldFailed {
+		if _, ok := newFailed[line]; !ok {
+			fixed = append(fixed, failure)
+		}
+	}
+	sortBaselineFailures(newlyFailing)
+	sortBaselineFailures(fixed)
+
+	if compareFailed {
+		fmt.Printf("%d newly failing, %d fixed, %d still failing bullets\n", len(newlyFailing), len(fixed), len(newFailed)-len(newlyFailing))
+	}
+	for _, failure := range newlyFailing {
+		fmt.Printf("NEW FAIL line#%d %s %s\n", failure.line, failure.route, failure.uri)
+	}
+	for _, failure := range fixed {
+		fmt.Printf("FIXED    line#%d %s %s\n", failure.line, failure.route, failure.uri)
+	}
+
+	oldRoutes := make(map[string]*reportRoute)
+	for i := range baseline.Routes {
+		oldRoutes[baseline.Routes[i].Route] = &baseline.Routes[i]
+	}
+
+	var slower int
+	for _, route := range report.Routes {
+		cmp := compareBaselineRoute(oldRoutes[route.Route], &route)
+		if cmp.regressed {
+			slower++
+		}
+
+		switch {
+		case cmp.onlyNew:
+			fmt.Printf("%s: new route, p50 %s p99 %s\n", cmp.route, formatUs(cmp.newP50), formatUs(cmp.newP99))
+		default:
+			change := `no significant change`
+			if cmp.slower {
+				change = `SLOWER`
+			} else if cmp.faster {
+				change = `faster`
+			}
+			if cmp.regressed {
+				change += ` (REGRESSION)`
+			}
+			fmt.Printf("%s: p50 %s -> %s (%+.1f%%), p99 %s -> %s (%+.1f%%), p-value %.4f: %s\n", cmp.route,
+				formatUs(cmp.oldP50), formatUs(cmp.newP50), percentChange(cmp.oldP50, cmp.newP50),
+				formatUs(cmp.oldP99), formatUs(cmp.newP99), percentChange(cmp.oldP99, cmp.newP99),
+				cmp.pValue, change)
+		}
+		delete(oldRoutes, route.Route)
+	}
+	gone := make([]string, 0, len(oldRoutes))
+	for route := range oldRoutes {
+		gone = append(gone, route)
+	}
+	sort.Strings(gone)
+	for _, route := range gone {
+		fmt.Printf("%s: not in this run\n", route)
+	}
+
+	if len(newlyFailing) == 0 && slower == 0 {
+		fmt.Println(`No regressions against baseline`)
+		return false, false
+	}
+	fmt.Printf("REGRESSION against baseline: %d newly failing bullets, %d slower routes\n", len(newlyFailing), slower)
+	return len(newlyFailing) > 0, slower > 0
+}
+
+func compareBaselineRoute(old, route *reportRoute) baselineRoute {
+	cmp := baselineRoute{route: route.Route, newP50: route.Latency.P50Us, newP99: route.Latency.P99Us}
+	if old == nil {
+		cmp.onlyNew = true
+		return cmp
+	}
+	cmp.oldP50, cmp.oldP99 = old.Latency.P50Us, old.Latency.P99Us
+
+	pValue, z := mannWhitney(old.LatencySampleUs, route.LatencySampleUs)
+	cmp.pValue = pValue
+	if pValue < baselineAlpha {
+		cmp.slower, cmp.faster = z > 0, z < 0
+	}
+	cmp.regressed = cmp.slower && float64(cmp.newP99) > float64(cmp.oldP99)*(1+argv.baselineTolerance)
+
+	return cmp
+}
+
+// baselineFailures - проваленные патроны отчета по номеру строки (патрон повторяется, если прогон не -test).
+// Полный список берется из failed_lines, подробности - из failures или патронов текущего прогона.
+// Отчеты без failed_lines полны, только если список failures не обрезан
+func baselineFailures(report *runReport) (failed map[int]baselineFailure, complete bool) {
+	failed = make(map[int]baselineFailure)
+	for _, failure := range report.Failures {
+		failed[failure.LineNo] = baselineFailure{line: failure.LineNo, route: failure.Route, uri: failure.URI}
+	}
+	if report.FailedLines == nil {
+		return failed, !report.FailuresTruncated && len(report.Failures) < maxReportFailures
+	}
+
+	var byLine map[int]*Bullet
+	for _, lineNo := range report.FailedLines {
+		if _, ok := failed[lineNo]; ok {
+			continue
+		}
+		if byLine == nil {
+			byLine = make(map[int]*Bullet, len(bullets))
+			for _, bullet := range bullets {
+				byLine[bullet.Request.LineNo] = bullet
+			}
+		}
+		failure := baselineFailure{line: lineNo}
+		if bullet, ok := byLine[lineNo]; ok {
+			failure.route, failure.uri = bullet.Route, string(bullet.Request.URI)
+		}
+		failed[lineNo] = failure
+	}
+	return failed, true
+}
+
+func sortBaselineFailures(failures []baselineFailure) {
+	sort.Slice(failures, func(i, j int) bool { return failures[i].line < failures[j].line })
+}
+
+func percentChange(before, after int64) float64 {
+	if before == 0 {
+		return 0
+	}
+	return 100 * float64(after-before) / float64(before)
+}
+
+func formatUs(us int64) string {
+	return fmt.Sprintf(`%.2fms`, float64(us)/1000)
+}
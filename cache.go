@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Формат кэша: magic, версия, формат патронов, размеры и mtime исходных файлов, число патронов и сами патроны.
+// Все числа - uvarint, байтовые поля - uvarint длина + данные.
+// При чтении байтовые поля патронов ссылаются прямо на отображенный в память файл.
+
+const (
+	bulletCacheVersion = 3
+)
+
+var (
+	bulletCacheMagic = []byte(`HLCB`)
+
+	ErrCacheStale  = errors.New(`Bullet cache is stale`)
+	ErrCacheFormat = errors.New(`Wrong bullet cache format`)
+)
+
+type (
+	cacheSource struct {
+		size, mtime int64
+	}
+
+	cacheReader struct {
+		data []byte
+		pos  int
+		err  error
+	}
+)
+
+func cacheSourceOf(fileName string) (src cacheSource, err error) {
+	fi, err := os.Stat(fileName)
+	if err != nil {
+		return src, err
+	}
+	return cacheSource{size: fi.Size(), mtime: fi.ModTime().UnixNano()}, nil
+}
+
+func cacheSources(fileNames ...string) ([]cacheSource, error) {
+	var srcs []cacheSource
+	for _, fileName := range fileNames {
+		src, err := cacheSourceOf(fileName)
+		if err != nil {
+			return nil, errors.Wrap(err, `os.Stat`)
+		}
+		srcs = append(srcs, src)
+	}
+	return srcs, nil
+}
+
+// readBulletCache читает патроны из кэша, если он сделан из тех же файлов в том же формате патронов
+func readBulletCache(cacheFileName, format string, sourceFileNames ...string) ([]*Bullet, error) {
+	srcs, err := cacheSources(sourceFileNames...)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := mmapFile(cacheFileName)
+	if err != nil {
+		return nil, errors.Wrap(err, `mmapFile`)
+	}
+
+	cachedBullets, err := parseBulletCache(data, format, srcs)
+	if err != nil {
+		// патроны ссылаются на отображение, поэтому освобождать его можно только при ошибке
+		munmapFile(data)
+		return nil, err
+	}
+
+	return cachedBullets, nil
+}
+
+func parseBulletCache(data []byte, format string, srcs []cacheSource) ([]*Bullet, error) {
+	if !bytes.HasPrefix(data, bulletCacheMagic) {
+		return nil, ErrCacheFormat
+	}
+
+	cr := &cacheReader{data: data, pos: len(bulletCacheMagic)}
+
+	if cr.uint() != bulletCacheVersion {
+		return nil, ErrCacheStale
+	}
+	if string(cr.bytes()) != format {
+		return nil, ErrCacheStale
+	}
+
+	if cr.uint() != uint64(len(srcs)) {
+		return nil, ErrCacheStale
+	}
+	for _, src := range srcs {
+		if int64(cr.uint()) != src.size || int64(cr.uint()) != src.mtime {
+			return nil, ErrCacheStale
+		}
+	}
+
+	count := cr.uint()
+	if cr.err != nil || count > uint64(len(data)) {
+		return nil, ErrCacheFormat
+	}
+
+	cachedBullets := make([]*Bullet, 0, count)
+	for i := uint64(0); i < count && cr.err == nil; i++ {
+		var bullet Bullet
+
+		bullet.Request.LineNo = int(cr.uint())
+		bullet.Request.IsGet = cr.uint() == 1
+		bullet.Request.Head = cr.bytes()
+		bullet.Request.Tag = cr.bytes()
+		bullet.Request.URI = cr.bytes()
+		if headersCount := cr.uint(); headersCount > 0 && headersCount < uint64(len(data)) {
+			bullet.Request.Headers = make([]Header, headersCount)
+			for h := range bullet.Request.Headers {
+				bullet.Request.Headers[h].Key = cr.bytes()
+				bullet.Request.Headers[h].Value = cr.bytes()
+			}
+		}
+		bullet.Request.Body = cr.bytes()
+
+		bullet.Response.Status = int(cr.uint())
+		bullet.Response.Body = cr.bytes()
+
+		cachedBullets = append(cachedBullets, &bullet)
+	}
+
+	if cr.err != nil {
+		return nil, cr.err
+	}
+
+	return cachedBullets, nil
+}
+
+func writeBulletCache(cacheFileName, format string, sourceFileNames []string, cachedBullets []*Bullet) error {
+	srcs, err := cacheSources(sourceFileNames...)
+	if err != nil {
+		return err
+	}
+
+	tmpFileName := cacheFileName + `.tmp`
+	fd, err := os.Create(tmpFileName)
+	if err != nil {
+		return errors.Wrap(err, `os.Create`)
+	}
+	defer os.Remove(tmpFileName)
+
+	wr := bufio.NewWriterSize(fd, 1<<20)
+	var buf [binary.MaxVarintLen64]byte
+
+	writeUint := func(v uint64) {
+		wr.Write(buf[:binary.PutUvarint(buf[:], v)])
+	}
+	writeBytes := func(b []byte) {
+		writeUint(uint64(len(b)))
+		wr.Write(b)
+	}
+	boolToUint := func(b bool) uint64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	wr.Write(bulletCacheMagic)
+	writeUint(bulletCacheVersion)
+	writeBytes([]byte(format))
+	writeUint(uint64(len(srcs)))
+	for _, src := range srcs {
+		writeUint(uint64(src.size))
+		writeUint(uint64(src.mtime))
+	}
+
+	writeUint(uint64(len(cachedBullets)))
+	for _, bullet := range cachedBullets {
+		writeUint(uint64(bullet.Request.LineNo))
+		writeUint(boolToUint(bullet.Request.IsGet))
+		writeBytes(bullet.Request.Head)
+		writeBytes(bullet.Request.Tag)
+		writeBytes(bullet.Request.URI)
+		writeUint(uint64(len(bullet.Request.Headers)))
+		for _, header := range bullet.Request.Headers {
+			writeBytes(header.Key)
+			writeBytes(header.Value)
+		}
+		writeBytes(bullet.Request.Body)
+
+		writeUint(uint64(bullet.Response.Status))
+		writeBytes(bullet.Response.Body)
+	}
+
+	if err := wr.Flush(); err != nil {
+		fd.Close()
+		return errors.Wrap(err, `bufio.Flush`)
+	}
+	if err := fd.Close(); err != nil {
+		return errors.Wrap(err, `fd.Close`)
+	}
+
+	return errors.Wrap(os.Rename(tmpFileName, cacheFileName), `os.Rename`)
+}
+
+func (cr *cacheReader) uint() uint64 {
+	if cr.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(cr.data[cr.pos:])
+	if n <= 0 {
+		cr.err = ErrCacheFormat
+		return 0
+	}
+	cr.pos += n
+	return v
+}
+
+func (cr *cacheReader) bytes() []byte {
+	ln := cr.uint()
+	if cr.err != nil {
+		return nil
+	} else if ln > uint64(len(cr.data)-cr.pos) {
+		cr.err = ErrCacheFormat
+		return nil
+	} else if ln == 0 {
+		return nil
+	}
+	b := cr.data[cr.pos : cr.pos+int(ln) : cr.pos+int(ln)]
+	cr.pos += int(ln)
+	return b
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// compareServers отправляет каждый патрон и на -addr, и на -compare-addr и сравнивает ответы между собой.
+// Файл ответов не нужен: эталоном служит второй сервер. Сообщает, разошелся ли хоть один ответ
+func compareServers() (bool, error) {
+	if err := selectPhase(); err != nil {
+		return false, err
+	}
+
+	allBullets, err := loadAmmo(phase.AmmoFile)
+	if err != nil {
+		return false, err
+	}
+
+	bullets = filterBullets(allBullets)
+	for _, bullet := range bullets {
+		bullet.Route = requestRoute(&bullet.Request)
+	}
+
+	concurrent := int(argv.concurrent)
+	if phase.IsWrite() || concurrent < 1 {
+		concurrent = 1
+	}
+
+	fmt.Println(`phase:`, phase)
+	fmt.Println(`bullets count:`, len(bullets))
+	fmt.Printf("Compare %s against %s in %d concurrent users\n", argv.serverAddr, argv.compareAddr, concurrent)
+
+	client := &fasthttp.Client{}
+
+	var (
+		next             int64 = -1
+		diverged         int64
+		durMain, durComp int64
+		muPrint          sync.Mutex
+	)
+
+	routes := newRouteStats()
+
+	wg := &sync.WaitGroup{}
+	wg.Add(concurrent)
+	for i := 0; i < concurrent; i++ {
+		go func() {
+			defer wg.Done()
+
+			myRoutes := make(map[string]*routeStat)
+
+			for {
+				idx := int(atomic.AddInt64(&next, 1))
+				if idx >= len(bullets) {
+					break
+				}
+				bullet := bullets[idx]
+
+				respMain, durM, errMain := doBulletRequest(client, argv.serverAddr, &bullet.Request)
+				atomic.AddInt64(&durMain, int64(durM))
+				respComp, durC, errComp := doBulletRequest(client, argv.compareAddr, &bullet.Request)
+				atomic.AddInt64(&durComp, int64(durC))
+
+				route, ok := myRoutes[bullet.Route]
+				if !ok {
+					route = &routeStat{}
+					myRoutes[bullet.Route] = route
+				}
+				route.queries++
+				route.dur += durM
+
+				var diffs []string
+				if errMain != nil || errComp != nil {
+					diffs = append(diffs, fmt.Sprintf(`transport: %v / %v`, errMain, errComp))
+				} else if respMain.Status != respComp.Status {
+					diffs = append(diffs, fmt.Sprintf(`status: %d != %d`, respMain.Status, respComp.Status))
+				} else if respMain.Status == 200 && (!equalResponseBodies(respMain.Body, respComp.Body) || !equalResponseBodies(respComp.Body, respMain.Body)) {
+					diffs = jsDiff(respMain.Body, respComp.Body)
+					if len(diffs) == 0 {
+						// jsEqual отличает то, что не видно в диффе (например, null без -allow-nulls)
+						diffs = append(diffs, `body: differs`)
+					}
+				}
+
+				if len(diffs) == 0 {
+					continue
+				}
+
+				route.failed++
+				atomic.AddInt64(&diverged, 1)
+
+				if !argv.hideFailed {
+					muPrint.Lock()
+					fmt.Printf("REQUEST  URI: %s (line#%d)\n", bullet.Request.URI, bullet.Request.LineNo)
+					if len(bullet.Request.Body) > 0 {
+						bodyReq, _, _ := getReqRespBodies(bullet, &BenchResult{})
+						fmt.Printf("REQUEST BODY: %s\n", bodyReq)
+					}
+					for _, diff := range diffs {
+						fmt.Printf("  %s\n", diff)
+					}
+					fmt.Println()
+					muPrint.Unlock()
+				}
+			}
+
+			routes.merge(myRoutes)
+		}()
+	}
+	wg.Wait()
+
+	if diverged == 0 {
+		fmt.Println(`All answers are the same`)
+	} else {
+		fmt.Printf("%d requests (%.2f%%) diverged\n", diverged, 100*float64(diverged)/float64(len(bullets)))
+	}
+	if len(bullets) > 0 {
+		fmt.Printf("avg latency: %s %s, %s %s\n",
+			argv.serverAddr, time.Duration(durMain/int64(len(bullets))),
+			argv.compareAddr, time.Duration(durComp/int64(len(bullets))),
+		)
+	}
+	routes.print()
+
+	return diverged > 0, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// convertAmmo перекладывает патроны (HAR, лог nginx, любой формат Танка) в формат контеста: -out.ammo и -out.answ.
+// С -oracle ответы вычисляются оракулом. Если ответов взять неоткуда, пишется только -out.ammo
+func convertAmmo() error {
+	if argv.out == `` {
+		return errors.Wrap(ErrNoOutput, `convert`)
+	}
+
+	if err := selectPhase(); err != nil {
+		return err
+	}
+
+	format, err := ammoFileFormat(phase.AmmoFile)
+	if err != nil {
+		return err
+	}
+
+	_, isImport := ammoImporters[format]
+	withAnswers := isImport || phase.AnswFile != `` || argv.oracle != ``
+
+	var allBullets []*Bullet
+	if argv.oracle != `` {
+		allBullets, err = loadOracleBullets(phase.AmmoFile)
+	} else if withAnswers {
+		allBullets, err = loadBullets(phase.AmmoFile, phase.AnswFile)
+	} else {
+		allBullets, err = loadAmmo(phase.AmmoFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	aw, err := createAmmoWriter(argv.out, withAnswers)
+	if err != nil {
+		return err
+	}
+
+	converted := filterBullets(allBullets)
+	for _, bullet := range converted {
+		if err := aw.write(&bullet.Request, &bullet.Response); err != nil {
+			aw.Close()
+			return err
+		}
+	}
+	if err := aw.Close(); err != nil {
+		return errors.Wrap(err, `close converted files`)
+	}
+
+	if withAnswers {
+		fmt.Printf("%d bullets written to %s.ammo and %s.answ\n", len(converted), argv.out, argv.out)
+	} else {
+		fmt.Printf("%d bullets written to %s.ammo (no answers)\n", len(converted), argv.out)
+	}
+
+	return nil
+}
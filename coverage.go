@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Покрытие патронами API accounts 2018 года: какие маршруты, параметры, операции, ключи группировки и их сочетания
+// и наборы полей POST встречаются в загруженных патронах и какая доля патронов прошла. Ключи статистики - "раздел\tзначение"
+
+const (
+	coverageRoutes      = `routes`
+	coverageFilter      = `filter params`
+	coverageOps         = `filter operators`
+	coverageGroupKeys   = `group keys`
+	coverageGroupKeySet = `group key sets`
+	coverageGroupParams = `group params`
+	coverageLocation    = `recommend/suggest params`
+	coverageLocationSet = `recommend/suggest param sets`
+	coveragePostFields  = `POST fields`
+)
+
+var (
+	coverageSections = []string{coverageRoutes, coverageFilter, coverageOps, coverageGroupKeys, coverageGroupKeySet, coverageGroupParams,
+		coverageLocation, coverageLocationSet, coveragePostFields}
+
+	coverageSpecGroupKeys = []string{`sex`, `status`, `interests`, `country`, `city`}
+
+	// coverageSpec - что описано в условиях контеста и должно встречаться в патронах
+	coverageSpec = map[string][]string{
+		coverageRoutes: {`GET:/accounts/filter/`, `GET:/accounts/group/`, `GET:/accounts/<id>/recommend/`, `GET:/accounts/<id>/suggest/`,
+			`POST:/accounts/new/`, `POST:/accounts/<id>/`, `POST:/accounts/likes/`},
+		coverageFilter: {`sex_eq`, `email_domain`, `email_lt`, `email_gt`, `status_eq`, `status_neq`, `fname_eq`, `fname_any`, `fname_null`,
+			`sname_eq`, `sname_starts`, `sname_null`, `phone_code`, `phone_null`, `country_eq`, `country_null`, `city_eq`, `city_any`, `city_null`,
+			`birth_lt`, `birth_gt`, `birth_year`, `interests_contains`, `interests_any`, `likes_contains`, `premium_now`, `premium_null`},
+		coverageOps:         {`_eq`, `_neq`, `_domain`, `_lt`, `_gt`, `_any`, `_null`, `_starts`, `_code`, `_year`, `_contains`, `_now`},
+		coverageGroupKeys:   coverageSpecGroupKeys,
+		coverageGroupKeySet: coverageSubsets(coverageSpecGroupKeys, 2, `,`),
+		coverageGroupParams: {`sex`, `status`, `fname`, `sname`, `country`, `city`, `birth`, `joined`, `interests`, `likes`, `order=1`, `order=-1`},
+		coverageLocation:    {`country`, `city`},
+		coverageLocationSet: {`recommend`, `recommend country`, `recommend city`, `suggest`, `suggest country`, `suggest city`},
+	}
+)
+
+// coverageSubsets - все сочетания из items размером от 1 до maxSize, элементы сочетания отсортированы и склеены через sep
+func coverageSubsets(items []string, maxSize int, sep string) []string {
+	sorted := append([]string(nil), items...)
+	sort.Strings(sorted)
+
+	var subsets []string
+	var walk func(from int, subset []string)
+	walk = func(from int, subset []string) {
+		if len(subset) > 0 {
+			subsets = append(subsets, strings.Join(subset, sep))
+		}
+		if len(subset) == maxSize {
+			return
+		}
+		for i := from; i < len(sorted); i++ {
+			walk(i+1, append(subset[:len(subset):len(subset)], sorted[i]))
+		}
+	}
+	walk(0, nil)
+
+	return subsets
+}
+
+// bulletCoverage возвращает ключи покрытия патрона
+func bulletCoverage(request *Request) []string {
+	untagged := *request
+	untagged.Tag = nil
+	route := requestRoute(&untagged)
+
+	items := []string{coverageRoutes + "\t" + route}
+
+	uri, err := url.ParseRequestURI(string(request.URI))
+	if err != nil {
+		return items
+	}
+	query, _ := url.ParseQuery(uri.RawQuery)
+
+	switch route {
+	case `GET:/accounts/filter/`:
+		for param := range query {
+			if param == `limit` || param == `query_id` {
+				continue
+			}
+			items = append(items, coverageFilter+"\t"+param)
+			if pos := strings.LastIndexByte(param, '_'); pos > 0 {
+				items = append(items, coverageOps+"\t"+param[pos:])
+			}
+		}
+
+	case `GET:/accounts/group/`:
+		for param, values := range query {
+			switch param {
+			case `limit`, `query_id`:
+			case `keys`:
+				keys := splitOracleList(values[0])
+				for _, key := range keys {
+					items = append(items, coverageGroupKeys+"\t"+key)
+				}
+				keys = append([]string(nil), keys...)
+				sort.Strings(keys)
+				items = append(items, coverageGroupKeySet+"\t"+strings.Join(keys, `,`))
+			case `order`:
+				items = append(items, coverageGroupParams+"\torder="+values[0])
+			default:
+				items = append(items, coverageGroupParams+"\t"+param)
+			}
+		}
+
+	case `GET:/accounts/<id>/recommend/`, `GET:/accounts/<id>/suggest/`:
+		var set []string
+		for param := range query {
+			if param != `limit` && param != `query_id` {
+				items = append(items, coverageLocation+"\t"+param)
+				set = append(set, param)
+			}
+		}
+		sort.Strings(set)
+		name := `recommend`
+		if route == `GET:/accounts/<id>/suggest/` {
+			name = `suggest`
+		}
+		items = append(items, coverageLocationSet+"\t"+strings.TrimSpace(name+` `+strings.Join(set, ` `)))
+
+	default:
+		if request.IsGet {
+			break
+		}
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(request.Body, &fields) != nil {
+			items = append(items, coveragePostFields+"\t"+route+` <invalid JSON>`)
+			break
+		}
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		items = append(items, coveragePostFields+"\t"+route+` {`+strings.Join(names, `,`)+`}`)
+	}
+
+	return items
+}
+
+// bulletsCoverage считает покрытие по загруженным патронам, каждый патрон один раз.
+// Патрон считается проваленным, если провалился хотя бы один его запрос (failed: индекс патрона -> вердикт)
+func bulletsCoverage(bullets []*Bullet, failed map[int]string) *routeStats {
+	rs := newRouteStats()
+	for bulletIdx, bullet := range bullets {
+		_, bulletFailed := failed[bulletIdx]
+		for _, item := range bulletCoverage(&bullet.Request) {
+			stat, ok := rs.stats[item]
+			if !ok {
+				stat = &routeStat{}
+				rs.stats[item] = stat
+			}
+			stat.queries++
+			if bulletFailed {
+				stat.failed++
+			}
+		}
+	}
+	return rs
+}
+
+func printCoverage(rs *routeStats) {
+	bySection := make(map[string][]string)
+	for key := range rs.stats {
+		parts := strings.SplitN(key, "\t", 2)
+		bySection[parts[0]] = append(bySection[parts[0]], parts[1])
+	}
+
+	fmt.Println("Coverage:")
+	var missing []string
+	for _, section := range coverageSections {
+		items := bySection[section]
+		sort.Strings(items)
+
+		for _, spec := range coverageSpec[section] {
+			if _, ok := rs.stats[section+"\t"+spec]; !ok {
+				missing = append(missing, section+`: `+spec)
+			}
+		}
+
+		if len(items) == 0 {
+			continue
+		}
+
+		fmt.Printf("  %s:\n", section)
+		for _, item := range items {
+			stat := rs.stats[section+"\t"+item]
+			passed := stat.queries - stat.failed
+			fmt.Printf("    %s: %d bullets, %.2f%% passed\n", item, stat.queries, 100*float64(passed)/float64(stat.queries))
+		}
+	}
+
+	if len(missing) > 0 {
+		fmt.Println("Never seen in ammo:")
+		for _, item := range missing {
+			fmt.Printf("  %s\n", item)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Выгрузка проваленных патронов (-dump-failed dir/) в раскладке hlcupdocs: dir/ammo/phase_N_action.ammo и dir/answers/*.answ.
+// В тег патрона дописывается #<номер строки в исходном файле>, при загрузке он возвращается в Request.LineNo,
+// так что повторный прогон с -hlcupdocs dir/ сообщает об ошибках в терминах исходных патронов
+
+var (
+	reLineTag = regexp.MustCompile(`^(.*)#(\d+)$`)
+)
+
+// dumpFailedBullets пишет патроны с индексами из failed в порядке исходного файла
+func dumpFailedBullets(dir string, failed map[int]string) error {
+	if len(failed) == 0 {
+		fmt.Println(`No failed bullets to dump`)
+		return nil
+	}
+
+	idxs := failedBulletIdxs(failed)
+
+	name := phase.Name
+	if !rePhaseFile.MatchString(name + `.ammo`) {
+		name = fmt.Sprintf(`phase_%d_%s`, phase.Num, phase.Action)
+	}
+
+	for _, sub := range []string{`ammo`, `answers`} {
+		if err := os.MkdirAll(path.Join(dir, sub), 0755); err != nil {
+			return errors.Wrap(err, `os.MkdirAll`)
+		}
+	}
+
+	ammo, err := os.Create(path.Join(dir, `ammo`, name+`.ammo`))
+	if err != nil {
+		return errors.Wrap(err, `os.Create`)
+	}
+
+	answ, err := os.Create(path.Join(dir, `answers`, name+`.answ`))
+	if err != nil {
+		ammo.Close()
+		return errors.Wrap(err, `os.Create`)
+	}
+
+	err = writeFailedBullets(ammo, answ, idxs)
+	if errClose := ammo.Close(); err == nil && errClose != nil {
+		err = errors.Wrap(errClose, `close ammo`)
+	}
+	if errClose := answ.Close(); err == nil && errClose != nil {
+		err = errors.Wrap(errClose, `close answers`)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d failed bullets written to %s\n", len(idxs), path.Join(dir, `ammo`, name+`.ammo`))
+	if phase.IsWrite() {
+		fmt.Println(`WARNING: only failed POSTs are dumped, the server state on rerun will differ from the full phase`)
+	}
+	fmt.Printf("Rerun them with: -hlcupdocs %s -phase %s\n", dir, name)
+
+	return nil
+}
+
+func writeFailedBullets(ammo, answ io.Writer, idxs []int) error {
+	for _, bulletIdx := range idxs {
+		bullet := bullets[bulletIdx]
+
+		request := bullet.Request
+		request.Tag = lineTag(&bullet.Request)
+		if err := writeAmmo(ammo, &request); err != nil {
+			return err
+		}
+		if err := writeAnswer(answ, &request, &bullet.Response); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// failedBulletIdxs - индексы проваленных патронов по возрастанию
+func failedBulletIdxs(failed map[int]string) []int {
+	idxs := make([]int, 0, len(failed))
+	for bulletIdx := range failed {
+		idxs = append(idxs, bulletIdx)
+	}
+	sort.Ints(idxs)
+	return idxs
+}
+
+// lineTag - тег патрона (или маршрут) с номером строки исходного файла: GET:/accounts/filter/#123
+func lineTag(request *Request) []byte {
+	tag := request.Tag
+	if len(tag) == 0 {
+		tag = []byte(requestRoute(request))
+	}
+	return []byte(string(tag) + `#` + strconv.Itoa(request.LineNo))
+}
+
+// restoreLineTag возвращает номер строки исходного файла из тега выгруженного патрона
+func restoreLineTag(request *Request) {
+	match := reLineTag.FindSubmatch(request.Tag)
+	if len(match) == 0 {
+		return
+	}
+	lineNo, err := strconv.Atoi(string(match[2]))
+	if err != nil {
+		return
+	}
+
+	request.LineNo = lineNo
+	request.Tag = match[1]
+	if len(request.Tag) == 0 {
+		request.Tag = nil
+	}
+}
@@ -14,6 +14,15 @@ func equalResponseBodies(bodyResponse, bodyBullet []byte) bool {
 	return jsEqualObjects(bodyResponse, bodyBullet)
 }
 
+// equalBulletBody сверяет тело ответа с ожидаемым телом патрона. Ответы, импортированные из HAR и логов nginx,
+// бывают не в JSON и сравниваются как есть
+func equalBulletBody(bodyResponse []byte, response *Response) bool {
+	if response.RawBody {
+		return bytes.Equal(bytes.TrimSpace(bodyResponse), bytes.TrimSpace(response.Body))
+	}
+	return equalResponseBodies(bodyResponse, response.Body)
+}
+
 func jsEqual(dataType jsonparser.ValueType, smthResponse, smthBullet []byte) bool {
 	switch dataType {
 	case jsonparser.Number:
@@ -145,3 +154,94 @@ func utf8MixedUnescaped(b []byte) []byte {
 
 	return unescaped
 }
+
+const (
+	maxJSDiffs = 10
+)
+
+// jsDiff возвращает смысловые различия двух JSON ответов в виде "путь: что не так".
+// Сравнение в обе стороны: и недостающие, и лишние поля
+func jsDiff(bodyGot, bodyExp []byte) []string {
+	var diffs []string
+
+	got, gotType, _, errGot := jsonparser.Get(bodyGot)
+	exp, expType, _, errExp := jsonparser.Get(bodyExp)
+	if errGot != nil || errExp != nil {
+		if !bytes.Equal(bytes.TrimSpace(bodyGot), bytes.TrimSpace(bodyExp)) {
+			diffs = append(diffs, `body: not a JSON, differs`)
+		}
+		return diffs
+	}
+
+	jsDiffValues(`$`, gotType, got, expType, exp, &diffs)
+
+	return diffs
+}
+
+func jsDiffValues(path string, gotType jsonparser.ValueType, got []byte, expType jsonparser.ValueType, exp []byte, diffs *[]string) {
+	if len(*diffs) >= maxJSDiffs {
+		return
+	}
+
+	if gotType != expType {
+		*diffs = append(*diffs, fmt.Sprintf(`%s: got %s %s, expected %s %s`, path, gotType, jsDiffShort(gotType, got), expType, jsDiffShort(expType, exp)))
+		return
+	}
+
+	switch gotType {
+	case jsonparser.Object:
+		jsonparser.ObjectEach(exp, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
+			if valueGot, dataTypeGot, _, err := jsonparser.Get(got, string(key)); err != nil {
+				*diffs = append(*diffs, fmt.Sprintf(`%s.%s: missing, expected %s`, path, key, jsDiffShort(dataType, value)))
+			} else {
+				jsDiffValues(path+`.`+string(key), dataTypeGot, valueGot, dataType, value, diffs)
+			}
+			return nil
+		})
+		jsonparser.ObjectEach(got, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
+			if _, _, _, err := jsonparser.Get(exp, string(key)); err != nil && len(*diffs) < maxJSDiffs {
+				*diffs = append(*diffs, fmt.Sprintf(`%s.%s: unexpected %s`, path, key, jsDiffShort(dataType, value)))
+			}
+			return nil
+		})
+
+	case jsonparser.Array:
+		type arrayItem struct {
+			dataType jsonparser.ValueType
+			value    []byte
+		}
+		collect := func(array []byte) (items []arrayItem) {
+			jsonparser.ArrayEach(array, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+				items = append(items, arrayItem{dataType: dataType, value: value})
+			})
+			return
+		}
+
+		itemsGot, itemsExp := collect(got), collect(exp)
+		if len(itemsGot) != len(itemsExp) {
+			*diffs = append(*diffs, fmt.Sprintf(`%s: got %d items, expected %d`, path, len(itemsGot), len(itemsExp)))
+		}
+		for i := 0; i < len(itemsGot) && i < len(itemsExp); i++ {
+			jsDiffValues(fmt.Sprintf(`%s[%d]`, path, i), itemsGot[i].dataType, itemsGot[i].value, itemsExp[i].dataType, itemsExp[i].value, diffs)
+		}
+
+	default:
+		if !jsEqual(gotType, got, exp) {
+			*diffs = append(*diffs, fmt.Sprintf(`%s: got %s, expected %s`, path, jsDiffShort(gotType, got), jsDiffShort(expType, exp)))
+		}
+	}
+}
+
+func jsDiffShort(dataType jsonparser.ValueType, value []byte) string {
+	const maxLen = 64
+
+	switch dataType {
+	case jsonparser.String:
+		return strconv.Quote(string(utf8Unescaped(value)))
+	case jsonparser.Object, jsonparser.Array:
+		if len(value) > maxLen {
+			return string(value[:maxLen]) + `...`
+		}
+	}
+	return string(value)
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Негативный фаззинг: валидные патроны портятся так, что по правилам контеста сервер обязан ответить 400 (или 404).
+// Выжившие мутанты - ответы с другим статусом. POST мутанты всегда невалидны, поэтому состояние сервера меняться не должно
+
+const (
+	fuzzUnknownParam = `unknown_param`
+	fuzzEmptyValue   = `empty_value`
+	fuzzBrokenNumber = `broken_number`
+	fuzzBadLimit     = `bad_limit`
+	fuzzBadEnum      = `bad_enum`
+	fuzzUnknownOp    = `unknown_op`
+	fuzzCorruptJSON  = `corrupt_json`
+	fuzzWrongType    = `wrong_type`
+	fuzzNullValue    = `null_value`
+	fuzzBadEmail     = `bad_email`
+	fuzzUnknownID    = `unknown_id`
+)
+
+var (
+	// fuzzNumberParams - параметры, значение которых обязано быть числом
+	fuzzNumberParams = map[string]bool{
+		`limit`: true, `birth_lt`: true, `birth_gt`: true, `birth_year`: true, `likes_contains`: true,
+		`birth`: true, `joined`: true, `likes`: true, `order`: true,
+	}
+
+	// fuzzEnumParams - параметры с фиксированным набором значений и заведомо невалидное значение для них
+	fuzzEnumParams = map[string]string{
+		`sex_eq`: `x`, `sex`: `x`, `status_eq`: `busy`, `status_neq`: `busy`, `status`: `busy`,
+		`premium_now`: `2`, `fname_null`: `2`, `sname_null`: `2`, `phone_null`: `2`, `country_null`: `2`,
+		`city_null`: `2`, `premium_null`: `2`, `keys`: `email`, `order`: `0`,
+	}
+
+	fuzzIntFields = map[string]bool{`id`: true, `birth`: true, `joined`: true, `liker`: true, `likee`: true, `ts`: true}
+)
+
+type (
+	fuzzMutant struct {
+		kind   string
+		bullet *Bullet
+	}
+
+	fuzzStat struct {
+		sent, survived int64
+	}
+)
+
+// fuzzServer отправляет на -addr мутантов патронов выбранной фазы и сообщает о тех, на которые сервер не ответил 400/404.
+// Возвращает, выжил ли хоть один мутант
+func fuzzServer() (bool, error) {
+	if err := selectPhase(); err != nil {
+		return false, err
+	}
+
+	allBullets, err := loadAmmo(phase.AmmoFile)
+	if err != nil {
+		return false, err
+	}
+
+	rnd := rand.New(rand.NewSource(argv.seed))
+
+	var mutants []fuzzMutant
+	for _, bullet := range filterBullets(allBullets) {
+		mutants = append(mutants, fuzzBullet(rnd, bullet)...)
+	}
+
+	concurrent := int(argv.concurrent)
+	if phase.IsWrite() || concurrent < 1 {
+		concurrent = 1
+	}
+
+	fmt.Println(`phase:`, phase)
+	fmt.Println(`mutants count:`, len(mutants))
+	fmt.Printf("Fuzz %s in %d concurrent users\n", argv.serverAddr, concurrent)
+
+	client := &fasthttp.Client{}
+
+	var (
+		next     int64 = -1
+		survived int64
+		muPrint  sync.Mutex
+	)
+
+	routes := newRouteStats()
+	kinds := make(map[string]*fuzzStat)
+	for _, mutant := range mutants {
+		if _, ok := kinds[mutant.kind]; !ok {
+			kinds[mutant.kind] = &fuzzStat{}
+		}
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(concurrent)
+	for i := 0; i < concurrent; i++ {
+		go func() {
+			defer wg.Done()
+
+			myRoutes := make(map[string]*routeStat)
+
+			for {
+				idx := int(atomic.AddInt64(&next, 1))
+				if idx >= len(mutants) {
+					break
+				}
+				mutant := mutants[idx]
+				bullet := mutant.bullet
+
+				resp, dur, err := doBulletRequest(client, argv.serverAddr, &bullet.Request)
+
+				route, ok := myRoutes[bullet.Route]
+				if !ok {
+					route = &routeStat{}
+					myRoutes[bullet.Route] = route
+				}
+				route.queries++
+				route.dur += dur
+
+				stat := kinds[mutant.kind]
+				atomic.AddInt64(&stat.sent, 1)
+
+				if err == nil && (resp.Status == 400 || resp.Status == 404) {
+					continue
+				}
+
+				route.failed++
+				atomic.AddInt64(&stat.survived, 1)
+				atomic.AddInt64(&survived, 1)
+
+				if !argv.hideFailed {
+					muPrint.Lock()
+					fmt.Printf("MUTANT %s of line#%d\nREQUEST  URI: %s\n", mutant.kind, bullet.Request.LineNo, bullet.Request.URI)
+					if len(bullet.Request.Body) > 0 {
+						bodyReq, _, _ := getReqRespBodies(bullet, &BenchResult{})
+						fmt.Printf("REQUEST BODY: %s\n", bodyReq)
+					}
+					if err != nil {
+						fmt.Printf("TRANSPORT ERROR: %s\n\n", err)
+					} else {
+						fmt.Printf("STATUS GOT: %d \nSTATUS EXP: 400 or 404\n\n", resp.Status)
+					}
+					muPrint.Unlock()
+				}
+			}
+
+			routes.merge(myRoutes)
+		}()
+	}
+	wg.Wait()
+
+	if survived == 0 {
+		fmt.Println(`All mutants are rejected`)
+	} else {
+		fmt.Printf("%d mutants (%.2f%%) survived\n", survived, 100*float64(survived)/float64(len(mutants)))
+		if phase.IsWrite() {
+			fmt.Println(`WARNING: survived POST mutants could change the server state, restart it before the next phases`)
+		}
+	}
+
+	names := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		names = append(names, kind)
+	}
+	sort.Strings(names)
+
+	fmt.Println("Mutations:")
+	for _, kind := range names {
+		fmt.Printf("%s: %d sent, %d survived\n", kind, kinds[kind].sent, kinds[kind].survived)
+	}
+	routes.print()
+
+	return survived > 0, nil
+}
+
+// fuzzBullet возвращает мутантов патрона: по одному на каждый применимый вид порчи
+func fuzzBullet(rnd *rand.Rand, bullet *Bullet) []fuzzMutant {
+	uri, err := url.ParseRequestURI(string(bullet.Request.URI))
+	if err != nil {
+		return nil
+	}
+
+	var mutants []fuzzMutant
+	add := func(kind, rawQuery string, body []byte) {
+		mutant := &Bullet{Request: bullet.Request}
+		mutant.Request.URI = []byte(uri.Path)
+		if rawQuery != `` {
+			mutant.Request.URI = append(mutant.Request.URI, '?')
+			mutant.Request.URI = append(mutant.Request.URI, rawQuery...)
+		}
+		mutant.Request.Body = body
+		mutant.Route = requestRoute(&bullet.Request)
+		mutants = append(mutants, fuzzMutant{kind: kind, bullet: mutant})
+	}
+
+	params := fuzzParseQuery(uri.RawQuery)
+
+	if bullet.Request.IsGet {
+		add(fuzzUnknownParam, fuzzEncodeQuery(append(params, [2]string{`fuzz_` + strconv.Itoa(rnd.Intn(1000)), `1`})), nil)
+
+		var candidates []int
+		for i, p := range params {
+			if p[0] != `query_id` {
+				candidates = append(candidates, i)
+			}
+		}
+		if len(candidates) > 0 {
+			i := candidates[rnd.Intn(len(candidates))]
+			add(fuzzEmptyValue, fuzzEncodeQuery(fuzzReplaceParam(params, i, params[i][0], ``)), nil)
+		}
+
+		for i, p := range params {
+			switch {
+			case p[0] == `limit`:
+				bad := []string{`0`, `-1`, `abc`, `1.5`}[rnd.Intn(4)]
+				add(fuzzBadLimit, fuzzEncodeQuery(fuzzReplaceParam(params, i, p[0], bad)), nil)
+			case fuzzNumberParams[p[0]]:
+				add(fuzzBrokenNumber, fuzzEncodeQuery(fuzzReplaceParam(params, i, p[0], p[1]+`x`)), nil)
+			}
+			if bad, ok := fuzzEnumParams[p[0]]; ok {
+				add(fuzzBadEnum, fuzzEncodeQuery(fuzzReplaceParam(params, i, p[0], bad)), nil)
+			}
+			if pos := strings.LastIndexByte(p[0], '_'); pos > 0 && strings.HasSuffix(uri.Path, `/filter/`) && p[0] != `query_id` {
+				add(fuzzUnknownOp, fuzzEncodeQuery(fuzzReplaceParam(params, i, p[0][:pos]+`_fuzz`, p[1])), nil)
+			}
+		}
+
+		return mutants
+	}
+
+	body := bullet.Request.Body
+	rawQuery := uri.RawQuery
+
+	if len(body) > 1 {
+		add(fuzzCorruptJSON, rawQuery, append([]byte{}, body[:len(body)/2]...))
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return mutants
+	}
+
+	// у /accounts/likes/ портится первый лайк, у остальных - поля аккаунта
+	target, wrap := fields, func(target map[string]json.RawMessage) []byte {
+		mutated, _ := json.Marshal(target)
+		return mutated
+	}
+	var likes []map[string]json.RawMessage
+	if raw, ok := fields[`likes`]; ok && strings.HasSuffix(uri.Path, `/likes/`) && json.Unmarshal(raw, &likes) == nil && len(likes) > 0 {
+		target, wrap = likes[0], func(like map[string]json.RawMessage) []byte {
+			likes[0] = like
+			mutated, _ := json.Marshal(map[string]interface{}{`likes`: likes})
+			return mutated
+		}
+	}
+
+	keys := make([]string, 0, len(target))
+	for key := range target {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if len(keys) > 0 {
+		key := keys[rnd.Intn(len(keys))]
+		wrong := json.RawMessage(`123`)
+		if fuzzIntFields[key] {
+			wrong = json.RawMessage(`"abc"`)
+		} else if key == `interests` || key == `likes` || key == `premium` {
+			wrong = json.RawMessage(`"x"`)
+		}
+		add(fuzzWrongType, rawQuery, wrap(fuzzReplaceField(target, key, wrong)))
+
+		key = keys[rnd.Intn(len(keys))]
+		add(fuzzNullValue, rawQuery, wrap(fuzzReplaceField(target, key, json.RawMessage(`null`))))
+	}
+
+	if _, ok := target[`email`]; ok {
+		add(fuzzBadEmail, rawQuery, wrap(fuzzReplaceField(target, `email`, json.RawMessage(`"fuzz.example.com"`))))
+	}
+
+	if match := reOraclePostRoute.FindStringSubmatch(uri.Path); len(match) > 0 && match[1] != `new` && match[1] != `likes` {
+		mutant := *uri
+		mutant.Path = `/accounts/` + strconv.Itoa(1000000000+rnd.Intn(1000000)) + `/`
+		uri = &mutant
+		add(fuzzUnknownID, rawQuery, bytes.TrimSpace(body))
+	}
+
+	return mutants
+}
+
+// fuzzParseQuery разбирает query с сохранением порядка параметров
+func fuzzParseQuery(rawQuery string) [][2]string {
+	var params [][2]string
+	for _, pair := range strings.Split(rawQuery, `&`) {
+		if pair == `` {
+			continue
+		}
+		kv := strings.SplitN(pair, `=`, 2)
+		key, _ := url.QueryUnescape(kv[0])
+		value := ``
+		if len(kv) == 2 {
+			value, _ = url.QueryUnescape(kv[1])
+		}
+		params = append(params, [2]string{key, value})
+	}
+	return params
+}
+
+func fuzzEncodeQuery(params [][2]string) string {
+	pairs := make([]string, 0, len(params))
+	for _, p := range params {
+		pairs = append(pairs, url.QueryEscape(p[0])+`=`+url.QueryEscape(p[1]))
+	}
+	return strings.Join(pairs, `&`)
+}
+
+func fuzzReplaceParam(params [][2]string, i int, key, value string) [][2]string {
+	mutated := append([][2]string{}, params...)
+	mutated[i] = [2]string{key, value}
+	return mutated
+}
+
+func fuzzReplaceField(fields map[string]json.RawMessage, key string, value json.RawMessage) map[string]json.RawMessage {
+	mutated := make(map[string]json.RawMessage, len(fields))
+	for k, v := range fields {
+		mutated[k] = v
+	}
+	mutated[key] = value
+	return mutated
+}
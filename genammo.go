@@ -0,0 +1,359 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Генератор GET патронов для /accounts/filter/, /group/, /<id>/recommend/ и /<id>/suggest/.
+// Значения условий берутся из случайных аккаунтов датасета, чтобы выборки чаще были непустыми
+
+var (
+	ErrWrongMix      = errors.New(`Wrong -gen-mix`)
+	ErrWrongMaxLimit = errors.New(`Wrong -gen-max-limit`)
+
+	genAmmoRoutes = []string{`filter`, `group`, `recommend`, `suggest`}
+
+	genAmmoHeaders = []Header{
+		{Key: []byte(`Host`), Value: []byte(`accounts.com`)},
+		{Key: []byte(`User-Agent`), Value: []byte(`highloadcup_tester`)},
+		{Key: []byte(`Accept`), Value: []byte(`*/*`)},
+	}
+
+	// genFilterFields - поле фильтра и генераторы условий по нему; на одно поле в запросе только одно условие
+	genFilterFields = []struct {
+		field string
+		ops   []string
+	}{
+		{`sex`, []string{`eq`}},
+		{`email`, []string{`domain`, `lt`, `gt`}},
+		{`status`, []string{`eq`, `neq`}},
+		{`fname`, []string{`eq`, `any`, `null`}},
+		{`sname`, []string{`eq`, `starts`, `null`}},
+		{`phone`, []string{`code`, `null`}},
+		{`country`, []string{`eq`, `null`}},
+		{`city`, []string{`eq`, `any`, `null`}},
+		{`birth`, []string{`lt`, `gt`, `year`}},
+		{`interests`, []string{`contains`, `any`}},
+		{`likes`, []string{`contains`}},
+		{`premium`, []string{`now`, `null`}},
+	}
+
+	genGroupFilters = []string{`sex`, `status`, `fname`, `sname`, `country`, `city`, `birth`, `joined`, `interests`, `likes`}
+
+	// genGroupKeys - ключи группировки в фиксированном порядке, чтобы при одном -seed патроны совпадали
+	genGroupKeys = func() []string {
+		var keys []string
+		for key := range oracleGroupKeys {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return keys
+	}()
+)
+
+type (
+	genParam struct {
+		key, value string
+	}
+
+	ammoGenerator struct {
+		rnd     *rand.Rand
+		model   *oracleModel
+		queryID int
+	}
+)
+
+func generateAmmo() error {
+	if argv.out == `` {
+		return errors.Wrap(ErrNoOutput, `gen-ammo`)
+	}
+	if argv.oracle == `` {
+		return errors.Wrap(ErrOracleData, `no dataset (-oracle)`)
+	}
+	if argv.genMaxLimit < 1 {
+		return errors.Wrap(ErrWrongMaxLimit, `must be at least 1`)
+	}
+
+	mix, err := parseGenMix(argv.genMix)
+	if err != nil {
+		return err
+	}
+
+	model, err := loadOracleModel(argv.oracle)
+	if err != nil {
+		return err
+	}
+
+	aw, err := createAmmoWriter(argv.out, argv.genAnswers)
+	if err != nil {
+		return err
+	}
+
+	gen := &ammoGenerator{rnd: rand.New(rand.NewSource(argv.seed)), model: model}
+
+	total := 0
+	for _, weight := range mix {
+		total += weight
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < int(argv.genRequests); i++ {
+		route := genAmmoRoutes[len(genAmmoRoutes)-1]
+		for x, r := gen.rnd.Intn(total), 0; r < len(genAmmoRoutes); r++ {
+			if x -= mix[genAmmoRoutes[r]]; x < 0 {
+				route = genAmmoRoutes[r]
+				break
+			}
+		}
+		counts[route]++
+
+		request := gen.request(route)
+		var response Response
+		if argv.genAnswers {
+			response = model.answer(&request)
+		}
+		if err := aw.write(&request, &response); err != nil {
+			aw.Close()
+			return err
+		}
+	}
+	if err := aw.Close(); err != nil {
+		return errors.Wrap(err, `close generated files`)
+	}
+
+	fmt.Printf("%d requests written to %s.ammo: %v\n", argv.genRequests, argv.out, counts)
+
+	return nil
+}
+
+// parseGenMix разбирает веса маршрутов вида filter:6,group:2,recommend:1,suggest:1
+func parseGenMix(mixValue string) (map[string]int, error) {
+	mix := make(map[string]int)
+	total := 0
+	for _, item := range strings.Split(mixValue, `,`) {
+		parts := strings.SplitN(item, `:`, 2)
+		if len(parts) != 2 || !containsString(genAmmoRoutes, parts[0]) {
+			return nil, errors.Wrap(ErrWrongMix, item)
+		}
+		weight, err := strconv.Atoi(parts[1])
+		if err != nil || weight < 0 {
+			return nil, errors.Wrap(ErrWrongMix, item)
+		}
+		mix[parts[0]] = weight
+		total += weight
+	}
+	if total == 0 {
+		return nil, errors.Wrap(ErrWrongMix, `all weights are zero`)
+	}
+	return mix, nil
+}
+
+func (g *ammoGenerator) request(route string) Request {
+	var (
+		uriPath string
+		params  []genParam
+	)
+
+	switch route {
+	case `filter`:
+		uriPath, params = `/accounts/filter/`, g.filterParams()
+	case `group`:
+		uriPath, params = `/accounts/group/`, g.groupParams()
+	default:
+		account := g.account(func(a *oracleAccount) bool { return route != `suggest` || len(a.Likes) > 0 })
+		uriPath = `/accounts/` + strconv.Itoa(account.ID) + `/` + route + `/`
+		params = g.locationParams()
+	}
+
+	g.queryID++
+	params = append(params,
+		genParam{`limit`, strconv.Itoa(1 + g.rnd.Intn(int(argv.genMaxLimit)))},
+		genParam{`query_id`, strconv.Itoa(g.queryID)},
+	)
+	g.rnd.Shuffle(len(params), func(i, j int) { params[i], params[j] = params[j], params[i] })
+
+	var query []string
+	for _, p := range params {
+		query = append(query, p.key+`=`+url.QueryEscape(p.value))
+	}
+
+	return Request{
+		IsGet:   true,
+		URI:     []byte(uriPath + `?` + strings.Join(query, `&`)),
+		Headers: genAmmoHeaders,
+	}
+}
+
+// account возвращает случайный аккаунт, по возможности подходящий под ok
+func (g *ammoGenerator) account(ok func(a *oracleAccount) bool) *oracleAccount {
+	var account *oracleAccount
+	for try := 0; try < 20; try++ {
+		account = g.model.sorted[g.rnd.Intn(len(g.model.sorted))]
+		if ok(account) {
+			break
+		}
+	}
+	return account
+}
+
+func (g *ammoGenerator) filterParams() []genParam {
+	var params []genParam
+	for _, idx := range g.rnd.Perm(len(genFilterFields))[:1+g.rnd.Intn(3)] {
+		f := genFilterFields[idx]
+		op := f.ops[g.rnd.Intn(len(f.ops))]
+		if p, ok := g.filterParam(f.field, op); ok {
+			params = append(params, p)
+		} else {
+			// у случайных аккаунтов поле пустое - проверим хотя бы его отсутствие
+			params = append(params, genParam{f.field + `_null`, `1`})
+		}
+	}
+	return params
+}
+
+func (g *ammoGenerator) filterParam(field, op string) (genParam, bool) {
+	key := field + `_` + op
+	if op == `null` {
+		return genParam{key, strconv.Itoa(g.rnd.Intn(2))}, true
+	}
+	if field == `premium` {
+		return genParam{key, `1`}, true
+	}
+
+	a := g.account(func(a *oracleAccount) bool { return genAccountValue(a, field) != `` })
+	value := genAccountValue(a, field)
+	if value == `` {
+		return genParam{}, false
+	}
+
+	switch key {
+	case `email_domain`:
+		value = emailDomain(a.Email)
+	case `email_lt`, `email_gt`:
+		value = a.Email[:1+g.rnd.Intn(2)]
+	case `status_neq`:
+		value = genStatuses[g.rnd.Intn(len(genStatuses))]
+	case `fname_any`, `city_any`:
+		value = strings.Join(g.values(field, value, 2+g.rnd.Intn(3)), `,`)
+	case `sname_starts`:
+		runes := []rune(value)
+		if len(runes) > 3 {
+			value = string(runes[:3])
+		}
+	case `phone_code`:
+		value = phoneCode(a.Phone)
+	case `birth_lt`, `birth_gt`:
+		value = strconv.FormatInt(a.Birth, 10)
+	case `birth_year`:
+		value = strconv.Itoa(yearOf(a.Birth))
+	case `interests_contains`, `interests_any`:
+		interests := append([]string{}, a.Interests...)
+		g.rnd.Shuffle(len(interests), func(i, j int) { interests[i], interests[j] = interests[j], interests[i] })
+		if n := 1 + g.rnd.Intn(3); len(interests) > n {
+			interests = interests[:n]
+		}
+		value = strings.Join(interests, `,`)
+	case `likes_contains`:
+		var ids []string
+		n := 1 + g.rnd.Intn(2)
+		for _, idx := range g.rnd.Perm(len(a.Likes)) {
+			if len(ids) == n {
+				break
+			}
+			ids = append(ids, strconv.Itoa(a.Likes[idx].ID))
+		}
+		value = strings.Join(ids, `,`)
+	}
+
+	return genParam{key, value}, true
+}
+
+// values собирает до n разных значений поля, начиная с first
+func (g *ammoGenerator) values(field, first string, n int) []string {
+	values := []string{first}
+	for try := 0; try < n*3 && len(values) < n; try++ {
+		if v := genAccountValue(g.model.sorted[g.rnd.Intn(len(g.model.sorted))], field); v != `` && !containsString(values, v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func (g *ammoGenerator) groupParams() []genParam {
+	keys := []string{}
+	for _, idx := range g.rnd.Perm(len(genGroupKeys))[:1+g.rnd.Intn(2)] {
+		keys = append(keys, genGroupKeys[idx])
+	}
+
+	params := []genParam{
+		{`keys`, strings.Join(keys, `,`)},
+		{`order`, []string{`1`, `-1`}[g.rnd.Intn(2)]},
+	}
+
+	if g.rnd.Intn(2) == 0 {
+		field := genGroupFilters[g.rnd.Intn(len(genGroupFilters))]
+		a := g.account(func(a *oracleAccount) bool { return genAccountValue(a, field) != `` })
+		if value := genAccountValue(a, field); value != `` {
+			switch field {
+			case `birth`:
+				value = strconv.Itoa(yearOf(a.Birth))
+			case `joined`:
+				value = strconv.Itoa(yearOf(a.Joined))
+			case `interests`:
+				value = a.Interests[g.rnd.Intn(len(a.Interests))]
+			case `likes`:
+				value = strconv.Itoa(a.Likes[g.rnd.Intn(len(a.Likes))].ID)
+			}
+			params = append(params, genParam{field, value})
+		}
+	}
+
+	return params
+}
+
+func (g *ammoGenerator) locationParams() []genParam {
+	switch g.rnd.Intn(4) {
+	case 0:
+		a := g.account(func(a *oracleAccount) bool { return a.Country != `` })
+		if a.Country != `` {
+			return []genParam{{`country`, a.Country}}
+		}
+	case 1:
+		a := g.account(func(a *oracleAccount) bool { return a.City != `` })
+		if a.City != `` {
+			return []genParam{{`city`, a.City}}
+		}
+	}
+	return nil
+}
+
+// genAccountValue - строковое значение поля аккаунта, пустое для null
+func genAccountValue(a *oracleAccount, field string) string {
+	switch field {
+	case `email`:
+		return a.Email
+	case `fname`:
+		return a.Fname
+	case `sname`:
+		return a.Sname
+	case `phone`:
+		return a.Phone
+	case `interests`:
+		return strings.Join(a.Interests, `,`)
+	case `likes`:
+		if len(a.Likes) > 0 {
+			return strconv.Itoa(a.Likes[0].ID)
+		}
+		return ``
+	case `birth`, `joined`:
+		return `-`
+	}
+	return groupKeyValue(a, field)
+}
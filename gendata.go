@@ -0,0 +1,285 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Генератор синтетических данных в формате 2018 года: data.zip с accounts_N.json по 10000 аккаунтов и options.txt.
+// Распределения подобраны на глаз по официальным данным: доли null полей, статусов, премиумов, длины списков интересов
+
+const (
+	genDataNow       = 1545834028 // как в options.txt рейтинговых данных
+	genDataChunkSize = 10000
+
+	genBirthFrom  = -631152000 // 1950-01-01
+	genBirthTo    = 1104537600 // 2005-01-01
+	genJoinedFrom = 1293840000 // 2011-01-01
+	genJoinedTo   = 1514764800 // 2018-01-01
+	genPremiumMin = 1514764800 // 2018-01-01
+)
+
+var (
+	genFnamesF = []string{`Анна`, `Мария`, `Елена`, `Ольга`, `Наталья`, `Екатерина`, `Татьяна`, `Ирина`, `Светлана`, `Юлия`,
+		`Алёна`, `Дарья`, `Полина`, `Виктория`, `Ксения`, `Алиса`, `Вероника`, `Софья`, `Лидия`, `Злата`,
+		`Милена`, `Кира`, `Валерия`, `Анастасия`, `Евгения`, `Регина`, `Инна`, `Жанна`, `Лилия`, `Нина`}
+	genFnamesM = []string{`Александр`, `Сергей`, `Андрей`, `Алексей`, `Дмитрий`, `Иван`, `Максим`, `Евгений`, `Михаил`, `Никита`,
+		`Артём`, `Роман`, `Павел`, `Денис`, `Егор`, `Владимир`, `Олег`, `Фёдор`, `Степан`, `Тимофей`,
+		`Виталий`, `Леонид`, `Ярослав`, `Григорий`, `Антон`, `Борис`, `Кирилл`, `Глеб`, `Матвей`, `Руслан`}
+	genSnameRoots = []string{`Иван`, `Петр`, `Смирн`, `Кузнец`, `Попов`, `Васильев`, `Соколов`, `Михайлов`, `Новиков`, `Фёдор`,
+		`Морозов`, `Волков`, `Алексеев`, `Лебедев`, `Семёнов`, `Егоров`, `Павлов`, `Козлов`, `Степанов`, `Николаев`,
+		`Орлов`, `Андреев`, `Макаров`, `Никитин`, `Захаров`, `Зайцев`, `Соловьёв`, `Борисов`, `Яковлев`, `Григорьев`,
+		`Романов`, `Воробьёв`, `Сергеев`, `Кузьмин`, `Фролов`, `Александров`, `Дмитриев`, `Королёв`, `Гусев`, `Киселёв`}
+	genDomains = []string{`mail.ru`, `yandex.ru`, `gmail.com`, `inbox.ru`, `list.ru`, `bk.ru`, `rambler.ru`, `ya.ru`,
+		`icloud.com`, `me.com`, `email.com`, `ymail.com`, `inbox.com`, `hotmail.com`}
+	genInterests = []string{`Кино`, `Пиво`, `Спортивные машины`, `Музыка`, `Фитнес`, `Путешествия`, `Книги`, `Компьютерные игры`,
+		`Танцы`, `Футбол`, `Рэп`, `Рок`, `Джаз`, `Поп рок`, `Хип хоп`, `Солнце`, `Пляжный отдых`, `Горы`, `Лыжи`, `Сноуборд`,
+		`Вкусно поесть`, `Кофе`, `Чай`, `Вино`, `Коктейли`, `Суши`, `Бургеры`, `Готовка`, `Выпечка`, `Кошки`,
+		`Собаки`, `Рыбалка`, `Охота`, `Театр`, `Опера`, `Живопись`, `Фотография`, `Мотоциклы`, `Велосипед`, `Бег`,
+		`Плавание`, `Йога`, `Медитация`, `Программирование`, `Наука`, `Космос`, `История`, `Политика`, `Мода`, `Шопинг`,
+		`Сериалы`, `Аниме`, `Комиксы`, `Настольные игры`, `Шахматы`, `Волейбол`, `Баскетбол`, `Хоккей`, `Теннис`, `Бокс`,
+		`Клубы`, `Вечеринки`, `Караоке`, `Стендап`, `Подкасты`, `Сад`, `Цветы`, `Рукоделие`, `Автомобили`, `Дача`,
+		`Романтика`, `Общение`, `Поцелуи`, `Объятия`, `Честность`, `Юмор`, `Красное вино`, `Белое вино`, `Спорт`, `Стейк`}
+	genSyllables = []string{`ро`, `ма`, `ли`, `сан`, `то`, `ве`, `ра`, `ни`, `ка`, `ло`, `мо`, `де`, `ти`, `гра`, `зи`,
+		`на`, `фи`, `ла`, `ста`, `бе`, `во`, `ри`, `ду`, `ан`, `ос`, `ем`, `ук`, `ия`, `ель`, `ург`}
+	genLatinSyllables = []string{`ro`, `ma`, `li`, `san`, `to`, `ve`, `ra`, `ni`, `ka`, `lo`, `mo`, `de`, `ti`, `gra`, `zi`,
+		`na`, `fi`, `la`, `sta`, `be`, `vo`, `ri`, `du`, `an`, `os`, `em`, `uk`, `ia`, `el`, `urg`}
+	genStatuses = []string{statusFree, statusFree, statusFree, statusFree, statusBusy, statusBusy, statusBusy, statusComplex, statusComplex, statusComplex}
+)
+
+type (
+	genAccount struct {
+		ID        int            `json:"id"`
+		Email     string         `json:"email"`
+		Fname     string         `json:"fname,omitempty"`
+		Sname     string         `json:"sname,omitempty"`
+		Phone     string         `json:"phone,omitempty"`
+		Sex       string         `json:"sex"`
+		Birth     int64          `json:"birth"`
+		Country   string         `json:"country,omitempty"`
+		City      string         `json:"city,omitempty"`
+		Joined    int64          `json:"joined"`
+		Status    string         `json:"status"`
+		Interests []string       `json:"interests,omitempty"`
+		Premium   *oraclePremium `json:"premium,omitempty"`
+		Likes     []oracleLike   `json:"likes,omitempty"`
+	}
+
+	// genWeighted выбирает элементы с убывающими (примерно по Ципфу) весами, как страны и города в реальных данных
+	genWeighted struct {
+		items []string
+		cum   []float64
+	}
+)
+
+func generateData() error {
+	if argv.out == `` {
+		return errors.Wrap(ErrNoOutput, `gen-data`)
+	}
+	if err := os.MkdirAll(argv.out, 0755); err != nil {
+		return errors.Wrap(err, `os.MkdirAll`)
+	}
+
+	count := int(argv.genAccounts)
+	rnd := rand.New(rand.NewSource(argv.seed))
+
+	countries := newGenWeighted(genNames(rnd, 70, 2, 3))
+	cities := newGenWeighted(genNames(rnd, 600, 2, 4))
+
+	// пол нужен заранее: лайки в основном ставятся противоположному полу
+	sexes := make([]bool, count+1)
+	for id := 1; id <= count; id++ {
+		sexes[id] = rnd.Intn(2) == 0
+	}
+
+	zipFileName := path.Join(argv.out, `data.zip`)
+	fd, err := os.Create(zipFileName)
+	if err != nil {
+		return errors.Wrap(err, `os.Create`)
+	}
+	defer fd.Close()
+
+	bw := bufio.NewWriterSize(fd, 1<<20)
+	zw := zip.NewWriter(bw)
+
+	options := fmt.Sprintf("%d\n0\n", genDataNow)
+	if w, err := zw.Create(`options.txt`); err != nil {
+		return errors.Wrap(err, `zip.Create`)
+	} else if _, err := w.Write([]byte(options)); err != nil {
+		return errors.Wrap(err, `zip.Write`)
+	}
+
+	chunk := make([]*genAccount, 0, genDataChunkSize)
+	chunkNo := 0
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		chunkNo++
+		w, err := zw.Create(`accounts_` + strconv.Itoa(chunkNo) + `.json`)
+		if err != nil {
+			return errors.Wrap(err, `zip.Create`)
+		}
+		if err := json.NewEncoder(w).Encode(struct {
+			Accounts []*genAccount `json:"accounts"`
+		}{chunk}); err != nil {
+			return errors.Wrap(err, `json.Encode`)
+		}
+		chunk = chunk[:0]
+		return nil
+	}
+
+	for id := 1; id <= count; id++ {
+		chunk = append(chunk, genOneAccount(rnd, id, sexes, countries, cities))
+		if len(chunk) == genDataChunkSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return errors.Wrap(err, `zip.Close`)
+	}
+	if err := bw.Flush(); err != nil {
+		return errors.Wrap(err, `bufio.Flush`)
+	}
+	if err := ioutil.WriteFile(path.Join(argv.out, `options.txt`), []byte(options), 0644); err != nil {
+		return errors.Wrap(err, `ioutil.WriteFile`)
+	}
+
+	fmt.Printf("%d accounts in %d chunks written to %s\n", count, chunkNo, zipFileName)
+
+	return nil
+}
+
+func genOneAccount(rnd *rand.Rand, id int, sexes []bool, countries, cities *genWeighted) *genAccount {
+	a := &genAccount{
+		ID:     id,
+		Birth:  genDataRange(rnd, genBirthFrom, genBirthTo),
+		Joined: genDataRange(rnd, genJoinedFrom, genJoinedTo),
+		Status: genStatuses[rnd.Intn(len(genStatuses))],
+	}
+
+	male := sexes[id]
+	if male {
+		a.Sex = `m`
+	} else {
+		a.Sex = `f`
+	}
+
+	// id в base36 после точки гарантирует уникальность email: в слогах точек нет, так что id отделяется однозначно
+	a.Email = genWord(rnd, genLatinSyllables, 2, 4) + `.` + strconv.FormatInt(int64(id), 36) + `@` + genDomains[rnd.Intn(len(genDomains))]
+
+	if rnd.Float64() < 0.85 {
+		if male {
+			a.Fname = genFnamesM[rnd.Intn(len(genFnamesM))]
+		} else {
+			a.Fname = genFnamesF[rnd.Intn(len(genFnamesF))]
+		}
+	}
+	if rnd.Float64() < 0.8 {
+		a.Sname = genSnameRoots[rnd.Intn(len(genSnameRoots))]
+		switch {
+		case male && strings.HasSuffix(a.Sname, `ов`), male && strings.HasSuffix(a.Sname, `ев`), male && strings.HasSuffix(a.Sname, `ёв`):
+		case male:
+			a.Sname += `ов`
+		case strings.HasSuffix(a.Sname, `ов`), strings.HasSuffix(a.Sname, `ев`), strings.HasSuffix(a.Sname, `ёв`):
+			a.Sname += `а`
+		default:
+			a.Sname += `ова`
+		}
+	}
+	if rnd.Float64() < 0.5 {
+		// номер выводится из id, поэтому телефоны не повторяются (до 10^7 аккаунтов)
+		a.Phone = fmt.Sprintf(`8(9%02d)%07d`, rnd.Intn(100), (id*7919)%10000000)
+	}
+	if rnd.Float64() < 0.75 {
+		a.Country = countries.pick(rnd)
+	}
+	if rnd.Float64() < 0.7 {
+		a.City = cities.pick(rnd)
+	}
+
+	for n := rnd.Intn(11); len(a.Interests) < n; {
+		if interest := genInterests[rnd.Intn(len(genInterests))]; !containsString(a.Interests, interest) {
+			a.Interests = append(a.Interests, interest)
+		}
+	}
+
+	if rnd.Float64() < 0.3 {
+		start := genDataRange(rnd, genPremiumMin, genDataNow)
+		months := []int64{1, 3, 6}[rnd.Intn(3)]
+		a.Premium = &oraclePremium{Start: start, Finish: start + months*30*24*3600}
+	}
+
+	likes := int(rnd.ExpFloat64() * argv.genLikes)
+	for i := 0; i < likes && len(sexes) > 2; i++ {
+		likee := 1 + rnd.Intn(len(sexes)-1)
+		if likee == id || (sexes[likee] == male && rnd.Float64() < 0.9) {
+			continue
+		}
+		a.Likes = append(a.Likes, oracleLike{ID: likee, Ts: genDataRange(rnd, a.Joined, genDataNow)})
+	}
+
+	return a
+}
+
+func genDataRange(rnd *rand.Rand, from, to int64) int64 {
+	if to <= from {
+		return from
+	}
+	return from + rnd.Int63n(to-from)
+}
+
+// genWord собирает выдуманное слово из слогов, как названия стран и городов в официальных данных
+func genWord(rnd *rand.Rand, syllables []string, minSyllables, maxSyllables int) string {
+	var sb strings.Builder
+	n := minSyllables + rnd.Intn(maxSyllables-minSyllables+1)
+	for i := 0; i < n; i++ {
+		sb.WriteString(syllables[rnd.Intn(len(syllables))])
+	}
+	return sb.String()
+}
+
+func genNames(rnd *rand.Rand, count, minSyllables, maxSyllables int) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for len(names) < count {
+		runes := []rune(genWord(rnd, genSyllables, minSyllables, maxSyllables))
+		if name := strings.ToUpper(string(runes[0])) + string(runes[1:]); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func newGenWeighted(items []string) *genWeighted {
+	w := &genWeighted{items: items}
+	sum := 0.0
+	for i := range items {
+		sum += 1 / float64(i+1)
+		w.cum = append(w.cum, sum)
+	}
+	return w
+}
+
+func (w *genWeighted) pick(rnd *rand.Rand) string {
+	x := rnd.Float64() * w.cum[len(w.cum)-1]
+	return w.items[sort.SearchFloat64s(w.cum, x)]
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/valyala/fasthttp"
+)
+
+// generateGolden прогоняет все патроны фазы через эталонный сервер -addr и пишет его ответы в -out.answ.
+// Пишущие фазы идут строго по порядку в один поток, читающие - в -concurrent потоков
+func generateGolden() error {
+	if argv.out == `` {
+		return errors.Wrap(ErrNoOutput, `golden`)
+	}
+
+	if err := selectPhase(); err != nil {
+		return err
+	}
+
+	// фильтры не применяются: ответы должны один в один соответствовать патронам
+	goldenBullets, err := loadAmmo(phase.AmmoFile)
+	if err != nil {
+		return err
+	}
+
+	concurrent := int(argv.concurrent)
+	if phase.IsWrite() || concurrent < 1 {
+		concurrent = 1
+	}
+
+	fmt.Printf("Generate answers for %d bullets of %s from %s in %d concurrent users\n", len(goldenBullets), phase, argv.serverAddr, concurrent)
+
+	client := &fasthttp.Client{}
+
+	var (
+		next     int64 = -1
+		firstErr error
+		muErr    sync.Mutex
+	)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(concurrent)
+	for i := 0; i < concurrent; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				idx := int(atomic.AddInt64(&next, 1))
+				if idx >= len(goldenBullets) {
+					return
+				}
+
+				bullet := goldenBullets[idx]
+				response, _, err := doBulletRequest(client, argv.serverAddr, &bullet.Request)
+				if err != nil {
+					muErr.Lock()
+					if firstErr == nil {
+						firstErr = errors.Wrap(err, fmt.Sprintf(`line#%d %s`, bullet.Request.LineNo, bullet.Request.URI))
+					}
+					muErr.Unlock()
+					atomic.StoreInt64(&next, int64(len(goldenBullets)))
+					return
+				}
+				bullet.Response = response
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	fd, err := os.Create(argv.out + `.answ`)
+	if err != nil {
+		return errors.Wrap(err, `os.Create`)
+	}
+	defer fd.Close()
+
+	wr := bufio.NewWriter(fd)
+	for _, bullet := range goldenBullets {
+		if err := writeAnswer(wr, &bullet.Request, &bullet.Response); err != nil {
+			return err
+		}
+	}
+	if err := wr.Flush(); err != nil {
+		return errors.Wrap(err, `bufio.Flush`)
+	}
+
+	fmt.Printf("%d answers written to %s.answ\n", len(goldenBullets), argv.out)
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Импорт реального трафика: HAR из devtools браузера и access.log nginx в формате combined
+
+const (
+	importAnswersNone   = `none`
+	importAnswersStatus = `status`
+	importAnswersFull   = `full`
+)
+
+type (
+	ammoImporter func(fileName string) ([]*Bullet, error)
+
+	harFile struct {
+		Log struct {
+			Entries []harEntry `json:"entries"`
+		} `json:"log"`
+	}
+
+	harEntry struct {
+		Request struct {
+			Method   string      `json:"method"`
+			URL      string      `json:"url"`
+			Headers  []harHeader `json:"headers"`
+			PostData *struct {
+				Text string `json:"text"`
+			} `json:"postData"`
+		} `json:"request"`
+		Response struct {
+			Status  int `json:"status"`
+			Content struct {
+				Text     string `json:"text"`
+				Encoding string `json:"encoding"`
+			} `json:"content"`
+		} `json:"response"`
+	}
+
+	harHeader struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+)
+
+var (
+	ammoImporters = map[string]ammoImporter{
+		ammoFormatHAR:   importHAR,
+		ammoFormatNginx: importNginx,
+	}
+
+	// $remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"
+	reNginxLine = regexp.MustCompile(`^\S+ \S+ \S+ \[[^\]]+\] "([A-Z]+) (\S+)[^"]*" (\d{3}) \S+(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?`)
+
+	// заголовки, которые не имеет смысла переносить в патроны
+	importSkipHeaders = map[string]bool{
+		`content-length`:  true,
+		`connection`:      true,
+		`accept-encoding`: true,
+		`keep-alive`:      true,
+	}
+)
+
+func importHAR(fileName string) ([]*Bullet, error) {
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, `os.Open`)
+	}
+	defer fd.Close()
+
+	var har harFile
+	if err := json.NewDecoder(fd).Decode(&har); err != nil {
+		return nil, errors.Wrap(err, `json.Decode`)
+	}
+
+	var (
+		imported []*Bullet
+		skipped  int
+	)
+
+	for i, entry := range har.Log.Entries {
+		var request Request
+		request.LineNo = i + 1
+
+		if !setImportedMethod(&request, entry.Request.Method) {
+			skipped++
+			continue
+		}
+
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil {
+			return nil, errors.Wrap(ErrWrongAmmoFile, fmt.Sprintf(`Wrong URL in entry#%d: %s`, i, entry.Request.URL))
+		}
+		request.URI = []byte(u.RequestURI())
+		request.Head = []byte(entry.Request.Method + ` ` + string(request.URI))
+
+		for _, header := range entry.Request.Headers {
+			if strings.HasPrefix(header.Name, `:`) || importSkipHeaders[strings.ToLower(header.Name)] {
+				continue
+			}
+			request.Headers = append(request.Headers, Header{Key: []byte(header.Name), Value: []byte(header.Value)})
+		}
+
+		if entry.Request.PostData != nil && len(entry.Request.PostData.Text) > 0 {
+			request.Body = []byte(entry.Request.PostData.Text)
+		}
+
+		body := []byte(entry.Response.Content.Text)
+		if entry.Response.Content.Encoding == `base64` {
+			if body, err = base64.StdEncoding.DecodeString(entry.Response.Content.Text); err != nil {
+				return nil, errors.Wrap(ErrWrongAmmoFile, fmt.Sprintf(`Wrong response body in entry#%d`, i))
+			}
+		}
+
+		imported = append(imported, &Bullet{Request: request, Response: importedResponse(entry.Response.Status, body)})
+	}
+
+	if skipped > 0 {
+		fmt.Printf("...skipped %d HAR entries with unsupported methods\n", skipped)
+	}
+
+	return imported, nil
+}
+
+func importNginx(fileName string) ([]*Bullet, error) {
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, `os.Open`)
+	}
+	defer fd.Close()
+
+	var (
+		imported []*Bullet
+		skipped  int
+	)
+
+	lineNo := 0
+	rd := bufio.NewReaderSize(fd, ammoReaderSize)
+	for {
+		line, err := readAmmoLine(rd, &lineNo)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf(`rd.ReadBytes in %s line#%d`, fileName, lineNo))
+		} else if len(line) == 0 {
+			continue
+		}
+
+		match := reNginxLine.FindSubmatch(line)
+		if len(match) == 0 {
+			return nil, errors.Wrap(ErrWrongAmmoFile, fmt.Sprintf(`Wrong log line in %s line#%d: %s`, fileName, lineNo, line))
+		}
+
+		var request Request
+		request.LineNo = lineNo
+		request.Head = line
+
+		if !setImportedMethod(&request, string(match[1])) {
+			skipped++
+			continue
+		}
+		request.URI = match[2]
+
+		if referer := match[4]; len(referer) > 0 && !bytes.Equal(referer, []byte(`-`)) {
+			request.Headers = append(request.Headers, Header{Key: []byte(`Referer`), Value: referer})
+		}
+		if userAgent := match[5]; len(userAgent) > 0 && !bytes.Equal(userAgent, []byte(`-`)) {
+			request.Headers = append(request.Headers, Header{Key: []byte(`User-Agent`), Value: userAgent})
+		}
+
+		status, _ := strconv.Atoi(string(match[3]))
+		imported = append(imported, &Bullet{Request: request, Response: importedResponse(status, nil)})
+	}
+
+	if skipped > 0 {
+		fmt.Printf("...skipped %d log lines with unsupported methods\n", skipped)
+	}
+
+	return imported, nil
+}
+
+func setImportedMethod(request *Request, method string) bool {
+	switch method {
+	case `GET`:
+		request.IsGet = true
+	case `POST`:
+		request.IsGet = false
+	default:
+		return false
+	}
+	return true
+}
+
+// importedResponse строит ожидаемый ответ согласно -import-answers.
+// Нулевой статус не проверяется, а пустой объект в ожидаемом теле совпадает с любым объектом
+func importedResponse(status int, body []byte) (response Response) {
+	switch argv.importAnswers {
+	case importAnswersNone:
+		return
+	case importAnswersStatus:
+		body = nil
+	}
+
+	response.Status = status
+	if len(body) > 0 {
+		response.Body = body
+		// записанный ответ может быть не JSON объектом (массив, текст), такой сверяется побайтно
+		trimmed := bytes.TrimSpace(body)
+		response.RawBody = len(trimmed) > 0 && trimmed[0] != '{'
+	} else if status == 200 {
+		response.Body = emptyPOSTResponseBody
+	}
+
+	return
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Проверки ответов API accounts 2018 года, которым не нужен файл ответов: сортировка, limit, набор полей,
+// дубликаты. Полезны для своих патронов без эталона и как дополнительная страховка к equalResponseBodies
+
+var (
+	reInvariantRoute = regexp.MustCompile(`^/accounts/(?:(filter|group)|(\d+)/(recommend|suggest))/$`)
+
+	invariantAllowedFields = map[string]map[string]bool{
+		`recommend`: {`id`: true, `email`: true, `status`: true, `fname`: true, `sname`: true, `birth`: true, `premium`: true},
+		`suggest`:   {`id`: true, `email`: true, `status`: true, `fname`: true, `sname`: true},
+	}
+)
+
+type (
+	invariantViolation struct {
+		name, detail string
+	}
+
+	invariantStats struct {
+		mu     sync.Mutex
+		counts map[string]int64
+	}
+)
+
+func (v invariantViolation) String() string {
+	return v.name + `: ` + v.detail
+}
+
+// checkInvariants проверяет успешный ответ на GET запрос к filter/group/recommend/suggest. Остальное не проверяется
+func checkInvariants(request *Request, status int, body []byte) []invariantViolation {
+	if !request.IsGet || status != 200 {
+		return nil
+	}
+
+	uri, err := url.ParseRequestURI(string(request.URI))
+	if err != nil {
+		return nil
+	}
+	match := reInvariantRoute.FindStringSubmatch(uri.Path)
+	if len(match) == 0 {
+		return nil
+	}
+	query, err := url.ParseQuery(uri.RawQuery)
+	if err != nil {
+		return nil
+	}
+	limit, _ := strconv.Atoi(query.Get(`limit`))
+
+	if match[1] == `group` {
+		return checkGroupInvariants(query, limit, body)
+	}
+
+	var resp struct {
+		Accounts []map[string]json.RawMessage `json:"accounts"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Accounts == nil {
+		return []invariantViolation{{`json`, `no "accounts" array in response`}}
+	}
+
+	var violations []invariantViolation
+	if limit > 0 && len(resp.Accounts) > limit {
+		violations = append(violations, invariantViolation{`limit`, fmt.Sprintf(`%d accounts for limit=%d`, len(resp.Accounts), limit)})
+	}
+
+	allowed := invariantAllowedFields[match[3]]
+	if match[1] == `filter` {
+		allowed = filterAllowedFields(query)
+	}
+
+	self, _ := strconv.Atoi(match[2])
+	seen := make(map[int]bool)
+	prevID := -1
+
+	for idx, account := range resp.Accounts {
+		var id int
+		if err := json.Unmarshal(account[`id`], &id); err != nil {
+			violations = append(violations, invariantViolation{`id`, fmt.Sprintf(`accounts[%d] without numeric id`, idx)})
+			continue
+		}
+
+		if seen[id] {
+			violations = append(violations, invariantViolation{`duplicate`, fmt.Sprintf(`id %d returned twice`, id)})
+		}
+		seen[id] = true
+
+		if match[2] != `` && id == self {
+			violations = append(violations, invariantViolation{`self`, fmt.Sprintf(`account %d returned for itself`, id)})
+		}
+
+		// /filter/ отдается по убыванию id; у suggest порядок убывающий только внутри каждого похожего аккаунта
+		if match[1] == `filter` && prevID >= 0 && id >= prevID {
+			violations = append(violations, invariantViolation{`order`, fmt.Sprintf(`id %d after %d`, id, prevID)})
+		}
+		prevID = id
+
+		for field := range account {
+			if !allowed[field] {
+				violations = append(violations, invariantViolation{`fields`, fmt.Sprintf(`unexpected field "%s" in account %d`, field, id)})
+			}
+		}
+	}
+
+	return violations
+}
+
+// filterAllowedFields - id, email и поля из условий запроса
+func filterAllowedFields(query url.Values) map[string]bool {
+	allowed := map[string]bool{`id`: true, `email`: true}
+	for param := range query {
+		if param == `query_id` {
+			continue
+		}
+		if pos := strings.LastIndexByte(param, '_'); pos > 0 {
+			allowed[param[:pos]] = true
+		}
+	}
+	// по этим полям фильтруют, но в ответ они не попадают
+	delete(allowed, `interests`)
+	delete(allowed, `likes`)
+	return allowed
+}
+
+func checkGroupInvariants(query url.Values, limit int, body []byte) []invariantViolation {
+	var resp struct {
+		Groups []map[string]json.RawMessage `json:"groups"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Groups == nil {
+		return []invariantViolation{{`json`, `no "groups" array in response`}}
+	}
+
+	var violations []invariantViolation
+	if limit > 0 && len(resp.Groups) > limit {
+		violations = append(violations, invariantViolation{`limit`, fmt.Sprintf(`%d groups for limit=%d`, len(resp.Groups), limit)})
+	}
+
+	keys := splitOracleList(query.Get(`keys`))
+	allowed := map[string]bool{`count`: true}
+	for _, key := range keys {
+		allowed[key] = true
+	}
+	desc := query.Get(`order`) == `-1`
+
+	var prev *oracleGroup
+	for idx, item := range resp.Groups {
+		g := &oracleGroup{values: make([]string, len(keys))}
+		if err := json.Unmarshal(item[`count`], &g.count); err != nil || g.count <= 0 {
+			violations = append(violations, invariantViolation{`count`, fmt.Sprintf(`groups[%d] without positive count`, idx)})
+		}
+		for field := range item {
+			if !allowed[field] {
+				violations = append(violations, invariantViolation{`fields`, fmt.Sprintf(`unexpected field "%s" in groups[%d]`, field, idx)})
+			}
+		}
+		for k, key := range keys {
+			json.Unmarshal(item[key], &g.values[k])
+		}
+
+		if prev != nil {
+			if equalGroups(prev, g) {
+				violations = append(violations, invariantViolation{`duplicate`, fmt.Sprintf(`groups[%d] repeats previous group`, idx)})
+			} else if lessGroup(g, prev) != desc {
+				violations = append(violations, invariantViolation{`order`, fmt.Sprintf(`groups[%d] is out of order`, idx)})
+			}
+		}
+		prev = g
+	}
+
+	return violations
+}
+
+// lessGroup сравнивает группы по count, затем по значениям ключей
+func lessGroup(a, b *oracleGroup) bool {
+	if a.count != b.count {
+		return a.count < b.count
+	}
+	for k := range a.values {
+		if a.values[k] != b.values[k] {
+			return a.values[k] < b.values[k]
+		}
+	}
+	return false
+}
+
+func newInvariantStats() *invariantStats {
+	return &invariantStats{counts: make(map[string]int64)}
+}
+
+func (is *invariantStats) add(violations []invariantViolation) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	for _, v := range violations {
+		is.counts[v.name]++
+	}
+}
+
+func (is *invariantStats) print() {
+	if len(is.counts) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(is.counts))
+	for name := range is.counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println("Invariant violations:")
+	for _, name := range names {
+		fmt.Printf("%s: %d\n", name, is.counts[name])
+	}
+}
@@ -9,48 +9,219 @@ import (
 	"path"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 )
 
 func loadData() error {
-	phase := int(argv.phase)
+	if err := selectPhase(); err != nil {
+		return err
+	}
+
+	var (
+		allBullets []*Bullet
+		err        error
+	)
+	if argv.oracle != `` {
+		allBullets, err = loadOracleBullets(phase.AmmoFile)
+	} else {
+		allBullets, err = loadBullets(phase.AmmoFile, phase.AnswFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	bullets = filterBullets(allBullets)
+	for _, bullet := range bullets {
+		bullet.Route = requestRoute(&bullet.Request)
+	}
+
+	return nil
+}
+
+// selectPhase выбирает фазу: файлы из -ammo/-answ, если они заданы, иначе по -phase среди найденных в hlcupdocs
+func selectPhase() error {
+	if argv.ammoFile != `` {
+		phase = &Phase{
+			Action:   `get`,
+			Name:     strings.TrimSuffix(path.Base(argv.ammoFile), path.Ext(argv.ammoFile)),
+			AmmoFile: argv.ammoFile,
+			AnswFile: argv.answFile,
+		}
+		return nil
+	}
 
-	phaseActions := [...]string{``, `get`, `post`, `get`}
-	if phase <= 0 || phase >= len(phaseActions) {
-		return errors.Wrap(ErrWrongPhase, strconv.Itoa(phase))
+	phases, err := discoverPhases(argv.hlcupdocsPath)
+	if err != nil {
+		return errors.Wrap(err, `!discoverPhases`)
+	}
+
+	phase, err = findPhase(phases, argv.phase)
+	return err
+}
+
+func loadBullets(ammoFileName, answFileName string) ([]*Bullet, error) {
+	format, err := ammoFileFormat(ammoFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	// HAR и логи nginx сами содержат ответы (или хотя бы статусы), отдельный файл ответов им не нужен
+	if importer, ok := ammoImporters[format]; ok {
+		imported, err := importer(ammoFileName)
+		setDirectPhaseAction(ammoFileName, imported)
+		return imported, err
 	}
 
-	filePrefix := fmt.Sprintf(`phase_%d_%s.`, phase, phaseActions[phase])
+	if answFileName == `` {
+		return nil, errors.Wrap(ErrNoAnswers, ammoFileName)
+	}
 
-	ammoFileName := path.Join(argv.hlcupdocsPath, `ammo`, filePrefix+`ammo`)
-	answFileName := path.Join(argv.hlcupdocsPath, `answers`, filePrefix+`answ`)
+	cacheFileName := ammoFileName + `.cache`
 
-	if requestChan, err := loadDataRequests(ammoFileName); err != nil {
-		return errors.Wrap(err, `!loadDataRequests`)
+	if argv.cache {
+		if cached, err := readBulletCache(cacheFileName, format, ammoFileName, answFileName); err == nil {
+			fmt.Println(`...using bullet cache`, cacheFileName)
+			setDirectPhaseAction(ammoFileName, cached)
+			return cached, nil
+		} else if !os.IsNotExist(errors.Cause(err)) && errors.Cause(err) != ErrCacheStale {
+			fmt.Println(`...bullet cache is broken, ignore it:`, err)
+		}
+	}
+
+	var allBullets []*Bullet
+
+	if requestChan, err := loadDataRequests(ammoFileName, format); err != nil {
+		return nil, errors.Wrap(err, `!loadDataRequests`)
 	} else if responseChan, err := loadDataResponses(answFileName); err != nil {
-		return errors.Wrap(err, `!loadDataResponses`)
+		return nil, errors.Wrap(err, `!loadDataResponses`)
 	} else {
 		for request := range requestChan {
+			restoreLineTag(&request)
 			response, ok := <-responseChan
 			if !ok {
-				return errors.Wrap(err, `Answers is not enought`)
-			}
-			if !request.Skip {
-				bullets = append(bullets, &Bullet{Request: request, Response: response})
+				return nil, errors.Wrap(ErrWrongAmmoFile, `Answers is not enought`)
 			}
+			allBullets = append(allBullets, &Bullet{Request: request, Response: response})
 		}
 	}
 
-	return nil
+	if argv.cache {
+		if err := writeBulletCache(cacheFileName, format, []string{ammoFileName, answFileName}, allBullets); err != nil {
+			fmt.Println(`...cannot write bullet cache:`, err)
+		}
+	}
+
+	setDirectPhaseAction(ammoFileName, allBullets)
+
+	return allBullets, nil
+}
+
+// loadAmmo загружает только запросы, без ожидаемых ответов
+func loadAmmo(ammoFileName string) ([]*Bullet, error) {
+	format, err := ammoFileFormat(ammoFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if importer, ok := ammoImporters[format]; ok {
+		imported, err := importer(ammoFileName)
+		setDirectPhaseAction(ammoFileName, imported)
+		return imported, err
+	}
+
+	requestChan, err := loadDataRequests(ammoFileName, format)
+	if err != nil {
+		return nil, errors.Wrap(err, `!loadDataRequests`)
+	}
+
+	var allBullets []*Bullet
+	for request := range requestChan {
+		restoreLineTag(&request)
+		allBullets = append(allBullets, &Bullet{Request: request})
+	}
+
+	setDirectPhaseAction(ammoFileName, allBullets)
+
+	return allBullets, nil
+}
+
+// setDirectPhaseAction определяет, пишущая ли фаза, заданная напрямую через -ammo: по наличию POST запросов
+// в ее патронах. Фазы hlcupdocs известны по имени файла, а патроны других файлов (-oracle-apply) фазу не меняют
+func setDirectPhaseAction(ammoFileName string, loaded []*Bullet) {
+	if phase == nil || phase.Num != 0 || ammoFileName != phase.AmmoFile {
+		return
+	}
+	for _, bullet := range loaded {
+		if !bullet.Request.IsGet {
+			phase.Action = `post`
+			return
+		}
+	}
 }
 
-func loadDataRequests(fileName string) (chan Request, error) {
+func filterBullets(allBullets []*Bullet) []*Bullet {
+	var (
+		rex  *regexp.Regexp
+		furi []byte
+	)
+
+	if len(argv.filterReq) > 0 {
+		fmt.Printf("...using filter %q\n", argv.filterReq)
+		rex = regexp.MustCompile(argv.filterReq)
+	}
+	if len(argv.filterURI) > 0 {
+		fmt.Printf("...using URI filter %q\n", argv.filterURI)
+		furi = []byte(argv.filterURI)
+	}
+
+	if rex == nil && furi == nil {
+		return allBullets
+	}
+
+	var filtered []*Bullet
+	for _, bullet := range allBullets {
+		if rex != nil && !rex.Match(bullet.Request.Head) {
+			continue
+		}
+		if furi != nil && !bytes.Contains(bullet.Request.URI, furi) {
+			continue
+		}
+		filtered = append(filtered, bullet)
+	}
+
+	return filtered
+}
+
+func ammoFileFormat(fileName string) (string, error) {
+	if argv.ammoFormat != ammoFormatAuto {
+		return argv.ammoFormat, nil
+	}
+
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return ``, errors.Wrap(err, `os.Open`)
+	}
+	defer fd.Close()
+
+	format, err := detectAmmoFormat(bufio.NewReaderSize(fd, ammoReaderSize))
+	return format, errors.Wrap(err, fileName)
+}
+
+func loadDataRequests(fileName, format string) (chan Request, error) {
+	parser, ok := ammoParsers[format]
+	if !ok {
+		return nil, errors.Wrap(ErrWrongAmmoFormat, format)
+	}
+
 	fd, err := os.Open(fileName)
 	if err != nil {
 		return nil, errors.Wrap(err, `os.Open`)
 	}
 
+	rd := bufio.NewReaderSize(fd, ammoReaderSize)
+
 	reqChan := make(chan Request, 100)
 
 	go func() {
@@ -59,111 +230,101 @@ func loadDataRequests(fileName string) (chan Request, error) {
 			close(reqChan)
 		}()
 
-		const (
-			stateBlockHeader = iota
-			stateQuery
-			stateHeaders
-			stateBody
-		)
-
-		var (
-			reFirstLine         = regexp.MustCompile(`^\d+( (GET|POST):|$)`)
-			reQuery             = regexp.MustCompile(`^(GET|POST) ([^\s]+) HTTP/`)
-			methodGET           = []byte(`GET`)
-			headerContentLength = []byte(`Content-Length`)
-			rex                 *regexp.Regexp
-			furi                []byte
-		)
-
-		if len(argv.filterReq) > 0 {
-			fmt.Printf("...using filter %q\n", argv.filterReq)
-			rex = regexp.MustCompile(argv.filterReq)
-		}
-		if len(argv.filterURI) > 0 {
-			fmt.Printf("...using URI filter %q\n", argv.filterURI)
-			furi = []byte(argv.filterURI)
-		}
+		parser(fileName, rd, reqChan)
+	}()
 
-		var (
-			request  Request
-			withBody bool
-		)
+	return reqChan, nil
+}
 
-		lineNo := 0
-		state := stateBlockHeader
-		rd := bufio.NewReader(fd)
-		for {
-			lineNo++
-			if line, err := rd.ReadBytes('\n'); err != nil {
-				if err == io.EOF {
-					break
+// parseAmmoHLC разбирает патроны в формате контеста: заголовок блока "size METHOD:/route", запрос построчно
+func parseAmmoHLC(fileName string, rd *bufio.Reader, reqChan chan<- Request) {
+	const (
+		stateBlockHeader = iota
+		stateQuery
+		stateHeaders
+		stateBody
+	)
+
+	var (
+		reFirstLine = regexp.MustCompile(`^\d+(\s|$)`)
+		reQuery     = regexp.MustCompile(`^(GET|POST) ([^\s]+) HTTP/`)
+		methodGET   = []byte(`GET`)
+	)
+
+	var (
+		request  Request
+		withBody bool
+	)
+
+	lineNo := 0
+	state := stateBlockHeader
+	for {
+		lineNo++
+		if line, err := rd.ReadBytes('\n'); err != nil {
+			if err == io.EOF {
+				break
+			}
+			panic(errors.Wrap(err, fmt.Sprintf(`rd.ReadBytes in %s line#%d`, fileName, lineNo)))
+		} else {
+			line = bytes.TrimSpace(line)
+
+			switch state {
+			case stateBlockHeader:
+				if !reFirstLine.Match(line) {
+					panic(errors.Wrap(ErrWrongAmmoFile, fmt.Sprintf(`Wrong block header in %s line#%d: [%s]`, fileName, lineNo, line)))
 				}
-				panic(errors.Wrap(err, fmt.Sprintf(`rd.ReadBytes in %s line#%d`, fileName, lineNo)))
-			} else {
-				line = bytes.TrimSpace(line)
-
-				switch state {
-				case stateBlockHeader:
-					if !reFirstLine.Match(line) {
-						panic(errors.Wrap(ErrWrongAmmoFile, fmt.Sprintf(`Wrong block header in %s line#%d: [%s]`, fileName, lineNo, line)))
-					}
-					state = stateQuery
+				state = stateQuery
 
-					// подготовка значений
-					withBody = false
+				// подготовка значений
+				withBody = false
 
-					request.LineNo = lineNo
-					request.URI = nil
-					request.IsGet = true
-					request.Headers = nil
-					request.Body = nil
-
-					if rex != nil {
-						request.Skip = !rex.Match(line)
-					}
+				request.LineNo = lineNo
+				request.Head = append([]byte{}, line...)
+				request.Tag = nil
+				if pos := bytes.IndexByte(request.Head, ' '); pos > 0 {
+					request.Tag = request.Head[pos+1:]
+				}
+				request.URI = nil
+				request.IsGet = true
+				request.Headers = nil
+				request.Body = nil
+
+			case stateQuery:
+				if match := reQuery.FindSubmatch(line); len(match) != 3 {
+					panic(errors.Wrap(ErrWrongAmmoFile, fmt.Sprintf(`Wrong query in %s line#%d: %s`, fileName, lineNo, line)))
+				} else {
+					request.IsGet = bytes.Equal(match[1], methodGET)
+					request.URI = append([]byte{}, match[2]...)
+				}
+				state = stateHeaders
 
-				case stateQuery:
-					if match := reQuery.FindSubmatch(line); len(match) != 3 {
-						panic(errors.Wrap(ErrWrongAmmoFile, fmt.Sprintf(`Wrong query in %s line#%d: %s`, fileName, lineNo, line)))
+			case stateHeaders:
+				if len(line) == 0 {
+					if request.IsGet || !withBody {
+						reqChan <- request
+						state = stateBlockHeader
 					} else {
-						request.IsGet = bytes.Equal(match[1], methodGET)
-						request.URI = append([]byte{}, match[2]...)
-						if furi != nil {
-							request.Skip = !bytes.Contains(request.URI, furi)
-						}
+						state = stateBody
 					}
-					state = stateHeaders
-
-				case stateHeaders:
-					if len(line) == 0 {
-						if request.IsGet || !withBody {
-							reqChan <- request
-							state = stateBlockHeader
-						} else {
-							state = stateBody
-						}
-					} else {
-						pos := bytes.IndexByte(line, ':')
-						key := line[0:pos]
-						value := bytes.TrimSpace(line[pos+1:])
+				} else {
+					pos := bytes.IndexByte(line, ':')
+					key := line[0:pos]
+					value := bytes.TrimSpace(line[pos+1:])
 
-						request.Headers = append(request.Headers, Header{Key: key, Value: value})
+					request.Headers = append(request.Headers, Header{Key: key, Value: value})
 
-						if bytes.Equal(key, headerContentLength) && !bytes.Equal(value, []byte{'0'}) { // хак учета "Content-Length: 0"
-							withBody = true
-						}
+					if bytes.Equal(key, headerContentLength) && !bytes.Equal(value, []byte{'0'}) { // хак учета "Content-Length: 0"
+						withBody = true
 					}
-
-				case stateBody:
-					request.Body = append([]byte{}, line...)
-					reqChan <- request
-					state = stateBlockHeader
 				}
+
+			case stateBody:
+				request.Body = append([]byte{}, line...)
+				reqChan <- request
+				state = stateBlockHeader
 			}
 		}
-	}()
-
-	return reqChan, nil
+	}
 }
 
 func loadDataResponses(fileName string) (chan Response, error) {
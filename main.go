@@ -4,7 +4,9 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
 	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -18,6 +20,15 @@ var (
 	ErrWrongPhase    = errors.New(`Wrong phase`)
 	ErrWrongAmmoFile = errors.New(`Cannot parse ammo file`)
 	ErrResponseDiff  = errors.New(`The server response is different than expected`)
+
+	ErrAmbiguousPhase = errors.New(`Ambiguous phase`)
+	ErrNoAnswers      = errors.New(`No answers file`)
+	ErrNoOutput       = errors.New(`No output path (-out)`)
+	ErrUnknownCommand = errors.New(`Unknown command`)
+)
+
+const (
+	requestTimeout = 2 * time.Second
 )
 
 var (
@@ -31,8 +42,9 @@ type (
 	}
 
 	Request struct {
-		Skip    bool
 		LineNo  int
+		Head    []byte
+		Tag     []byte
 		IsGet   bool
 		URI     []byte
 		Headers []Header
@@ -40,20 +52,25 @@ type (
 	}
 
 	Response struct {
-		Status int
-		Body   []byte
+		Status  int
+		Body    []byte
+		RawBody bool // тело не JSON объект (импорт из HAR), сравнивается побайтно
 	}
 
 	Bullet struct {
 		Request  Request
 		Response Response
+		Route    string
 	}
 
 	BenchResult struct {
 		bulletIdx int
 		status    int
+		timeout   bool
 		body      []byte
+		start     time.Time
 		dur       time.Duration
+		verdict   string // заполняется сразу в воркере, если нужен потоковому логу или метрикам
 	}
 
 	BenchTop struct {
@@ -64,11 +81,13 @@ type (
 
 var (
 	argv struct {
+		command       string
 		hlcupdocsPath string
 		serverAddr    string
 		filterReq     string
 		filterURI     string
-		phase         uint
+		phase         string
+		listPhases    bool
 		benchTime     time.Duration
 		concurrent    uint
 		testRun       bool
@@ -77,11 +96,45 @@ var (
 		utf8          bool
 		bodyDiff      bool
 		tankRps       uint
+		cache         bool
+		ammoFormat    string
+		ammoFile      string
+		answFile      string
+		importAnswers string
+		out           string
+		listen        string
+		compareAddr   string
+		oracle        string
+		oracleApply   string
+		seed          int64
+		genAccounts   uint
+		genLikes      float64
+		genRequests   uint
+		genMix        string
+		genMaxLimit   uint
+		genAnswers    bool
+		invariants    bool
+		paramStats    bool
+		coverage      bool
+		reportJSON    string
+		reportJUnit   string
+		logPhout      string
+		logNDJSON     string
+		reportHTML    string
+		timeSeries    string
+		metricsListen string
+
+		baseline          string
+		baselineTolerance float64
+		assert            string
+		dumpFailed        string
+		repro             string
 	}
 
 	maxReqNo   int
 	muMaxReqNo sync.Mutex
 
+	phase   *Phase
 	bullets []*Bullet
 
 	emptyPOSTResponseBody = []byte(`{}`)
@@ -90,9 +143,42 @@ var (
 func init() {
 	flag.StringVar(&argv.hlcupdocsPath, `hlcupdocs`, `./hlcupdocs/`, `path to hlcupdocs/`)
 	flag.StringVar(&argv.serverAddr, `addr`, `http://127.0.0.1:80`, `test server address`)
+	flag.StringVar(&argv.compareAddr, `compare-addr`, ``, `second server address: compare -addr responses with it instead of answers file`)
+	flag.StringVar(&argv.oracle, `oracle`, ``, `compute answers with local oracle from data.zip (path to data.zip or dir with data.zip and options.txt) instead of answers file`)
+	flag.StringVar(&argv.oracleApply, `oracle-apply`, ``, `comma separated ammo files with POSTs to apply to oracle before answering (default: write phases before -phase)`)
 	flag.StringVar(&argv.filterReq, `filter`, ``, `regexp for filter requests, i.e. "^458 " or "/accounts/filter/"`)
 	flag.StringVar(&argv.filterURI, `uri`, ``, `substring for filter requests URI`)
-	flag.UintVar(&argv.phase, `phase`, 1, `phase number (1, 2, 3)`)
+	flag.StringVar(&argv.phase, `phase`, `1`, `phase number or name (1, 2, post, phase_3_get...)`)
+	flag.BoolVar(&argv.cache, `cache`, true, `use pre-parsed bullet cache (*.ammo.cache next to ammo file)`)
+	flag.StringVar(&argv.ammoFormat, `ammo-format`, ammoFormatAuto, `ammo format: auto, hlc, phantom, uri, uripost`)
+	flag.StringVar(&argv.ammoFile, `ammo`, ``, `ammo file to use instead of hlcupdocs phases (any -ammo-format, HAR or nginx access.log)`)
+	flag.StringVar(&argv.answFile, `answ`, ``, `answers file for -ammo`)
+	flag.StringVar(&argv.importAnswers, `import-answers`, importAnswersStatus, `what to check for HAR/nginx bullets: none, status, full (HAR response bodies)`)
+	flag.StringVar(&argv.out, `out`, ``, `output path prefix for commands writing files`)
+	flag.StringVar(&argv.listen, `listen`, `:8080`, `listen address for record and serve commands`)
+	flag.Int64Var(&argv.seed, `seed`, 1, `random seed for generating commands`)
+	flag.UintVar(&argv.genAccounts, `gen-accounts`, 30000, `number of accounts for gen-data`)
+	flag.Float64Var(&argv.genLikes, `gen-likes`, 20, `average likes per account for gen-data`)
+	flag.UintVar(&argv.genRequests, `gen-requests`, 10000, `number of requests for gen-ammo`)
+	flag.StringVar(&argv.genMix, `gen-mix`, `filter:6,group:2,recommend:1,suggest:1`, `route weights for gen-ammo`)
+	flag.UintVar(&argv.genMaxLimit, `gen-max-limit`, 50, `max limit in gen-ammo requests`)
+	flag.BoolVar(&argv.genAnswers, `gen-answers`, false, `gen-ammo also writes oracle answers to -out.answ`)
+	flag.BoolVar(&argv.invariants, `invariants`, false, `check answer-free invariants of accounts API responses (order, limit, fields, duplicates)`)
+	flag.BoolVar(&argv.paramStats, `param-stats`, false, `print failure rate and p99 latency by /filter/ and /group/ params and their combinations`)
+	flag.BoolVar(&argv.coverage, `coverage`, false, `print which routes, params, operators, group keys and POST fields the ammo covers, with pass rates`)
+	flag.StringVar(&argv.reportJSON, `report-json`, ``, `write run report (config, phase and route stats, percentiles, failures, top slow) to this JSON file`)
+	flag.StringVar(&argv.reportJUnit, `report-junit`, ``, `write run report as JUnit XML (route - test case) to this file`)
+	flag.StringVar(&argv.reportHTML, `report-html`, ``, `write self-contained HTML report with charts, failure taxonomy and diffs to this file`)
+	flag.StringVar(&argv.logPhout, `log-phout`, ``, `stream every request result to this file in Yandex.Tank phout.txt format`)
+	flag.StringVar(&argv.logNDJSON, `log-ndjson`, ``, `stream every request result (ts, line, route, status, latency, bytes, verdict) to this NDJSON file`)
+	flag.StringVar(&argv.timeSeries, `timeseries`, ``, `write per-second rps, errors by class and latency percentiles per route to this CSV (or *.json) file`)
+	flag.StringVar(&argv.metricsListen, `metrics-listen`, ``, `serve live Prometheus metrics (requests, latency, in-flight, connections) on this address, i.e. ":9100"`)
+	flag.StringVar(&argv.baseline, `baseline`, ``, `compare this run with a saved -report-json: new and fixed failures, latency changes. Exit code 2 on new failures, 3 on slower routes`)
+	flag.Float64Var(&argv.baselineTolerance, `baseline-tolerance`, 0.1, `allowed p99 growth against -baseline for a significantly slower route (0.1 = 10%)`)
+	flag.StringVar(&argv.assert, `assert`, ``, `comma separated SLO checks after the run, i.e. "max-error-rate=0,no-transport-errors,min-rps=20000,p99<5ms,p99[/filter/]<2ms". Exit code 2 on correctness, 3 on performance failures`)
+	flag.StringVar(&argv.dumpFailed, `dump-failed`, ``, `write failed bullets as dir/ammo/phase_N_action.ammo and dir/answers/phase_N_action.answ (original line numbers in tags) to rerun with -hlcupdocs dir/`)
+	flag.StringVar(&argv.repro, `repro`, ``, `write reproductions of failed bullets to this dir: curl commands (failed.sh), .http file (failed.http) and Go test table (failed_test.go)`)
+	flag.BoolVar(&argv.listPhases, `list-phases`, false, `list phases found in hlcupdocs and exit`)
 	flag.DurationVar(&argv.benchTime, `time`, 10*time.Second, `benchmark duration`)
 	flag.BoolVar(&argv.testRun, `test`, false, `test run (send every query only once. ignore -time and -concurrent)`)
 	flag.BoolVar(&argv.hideFailed, `hide-failed`, false, `do not print info about every failed request`)
@@ -103,16 +189,100 @@ func init() {
 	flag.UintVar(&argv.concurrent, `concurrent`, 1, `concurrent users`)
 	flag.UintVar(&argv.tankRps, `tank`, 0, `run as tank: 0 -> this (rps) for benchmark duration. ignore -concurrent`)
 
-	flag.Parse()
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), `  (none)   test or benchmark the server`)
+		fmt.Fprintln(flag.CommandLine.Output(), `  convert  convert -ammo (HAR, nginx log, Tank ammo) to -out.ammo and -out.answ`)
+		fmt.Fprintln(flag.CommandLine.Output(), `  golden   send -phase or -ammo bullets to reference -addr and write its responses to -out.answ`)
+		fmt.Fprintln(flag.CommandLine.Output(), `  serve    mock server on -listen replying with recorded answers of -phase (or -ammo/-answ)`)
+		fmt.Fprintln(flag.CommandLine.Output(), `  record   proxy -listen to -addr and record requests and responses to -out.ammo and -out.answ`)
+		fmt.Fprintln(flag.CommandLine.Output(), `  gen-data synthetic -gen-accounts dataset: -out/data.zip and -out/options.txt`)
+		fmt.Fprintln(flag.CommandLine.Output(), `  gen-ammo random filter/group/recommend/suggest requests over -oracle dataset to -out.ammo (-gen-answers: and -out.answ)`)
+		fmt.Fprintln(flag.CommandLine.Output(), `  fuzz     send invalid mutants of -phase bullets to -addr and report those not rejected with 400/404`)
+		fmt.Fprintln(flag.CommandLine.Output(), "\nFlags:")
+		flag.PrintDefaults()
+	}
+
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], `-`) {
+		argv.command, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
 }
 
 func main() {
+	switch argv.command {
+	case ``:
+	case `convert`:
+		if err := convertAmmo(); err != nil {
+			log.Fatalln(errors.Wrap(err, `Cannot convert ammo`))
+		}
+		return
+	case `golden`:
+		if err := generateGolden(); err != nil {
+			log.Fatalln(errors.Wrap(err, `Cannot generate answers`))
+		}
+		return
+	case `serve`:
+		if err := serveAnswers(); err != nil {
+			log.Fatalln(errors.Wrap(err, `Cannot serve answers`))
+		}
+		return
+	case `record`:
+		if err := recordProxy(); err != nil {
+			log.Fatalln(errors.Wrap(err, `Cannot record`))
+		}
+		return
+	case `gen-data`:
+		if err := generateData(); err != nil {
+			log.Fatalln(errors.Wrap(err, `Cannot generate data`))
+		}
+		return
+	case `fuzz`:
+		survived, err := fuzzServer()
+		if err != nil {
+			log.Fatalln(errors.Wrap(err, `Cannot fuzz`))
+		}
+		if survived {
+			os.Exit(exitCodeCorrectness)
+		}
+		return
+	case `gen-ammo`:
+		if err := generateAmmo(); err != nil {
+			log.Fatalln(errors.Wrap(err, `Cannot generate ammo`))
+		}
+		return
+	default:
+		log.Fatalln(errors.Wrap(ErrUnknownCommand, argv.command))
+	}
+
+	if argv.listPhases {
+		if err := listPhases(); err != nil {
+			log.Fatalln(errors.Wrap(err, `Cannot list phases in `+argv.hlcupdocsPath))
+		}
+		return
+	}
+
+	if argv.compareAddr != `` {
+		diverged, err := compareServers()
+		if err != nil {
+			log.Fatalln(errors.Wrap(err, `Cannot compare servers`))
+		}
+		if diverged {
+			os.Exit(exitCodeCorrectness)
+		}
+		return
+	}
+
 	if err := loadData(); err != nil {
 		log.Fatalln(errors.Wrap(err, `Cannot load data from `+argv.hlcupdocsPath))
 	}
 
+	fmt.Println(`phase:`, phase)
 	fmt.Println(`bullets count:`, len(bullets))
 
+	applyPhaseDefaults()
+
 	benchServer()
 }
 
@@ -121,7 +291,8 @@ func benchServer() {
 
 	client := &fasthttp.Client{}
 
-	mt := time.Now().UnixNano()
+	benchStart := time.Now()
+	mt := benchStart.UnixNano()
 
 	var enough, currBullet int64
 
@@ -132,6 +303,29 @@ func benchServer() {
 		concurrent = 1
 	}
 
+	var (
+		err      error
+		baseline *runReport
+		asserts  []sloAssertion
+	)
+	if argv.baseline != `` {
+		if baseline, err = loadBaseline(argv.baseline); err != nil {
+			log.Fatalln(errors.Wrap(err, `Cannot load baseline`))
+		}
+	}
+	if argv.assert != `` {
+		if asserts, err = parseAssertions(argv.assert); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if resultLog, err = openRequestLog(); err != nil {
+		log.Fatalln(errors.Wrap(err, `Cannot open request log`))
+	}
+	if liveMetrics, err = openRunMetrics(client); err != nil {
+		log.Fatalln(errors.Wrap(err, `Cannot start metrics server`))
+	}
+
 	var benchResultsAll benchResult
 	wg := &sync.WaitGroup{}
 
@@ -174,6 +368,11 @@ func benchServer() {
 
 	wg.Wait()
 
+	if err := resultLog.Close(); err != nil {
+		log.Fatalln(errors.Wrap(err, `Cannot write request log`))
+	}
+	liveMetrics.Close()
+
 	mt = (time.Now().UnixNano() - mt) / int64(time.Millisecond)
 	rps := float64(queries) / (float64(mt) / 1000)
 
@@ -181,6 +380,21 @@ func benchServer() {
 
 	var benchtop [10]*BenchTop
 	chtop := make(chan *BenchTop, 100)
+	chtopDone := make(chan struct{})
+
+	routes := newRouteStats()
+	invariants := newInvariantStats()
+	params := newParamStats()
+	series := newTimeSeries(benchStart)
+	withSeries := argv.timeSeries != `` || argv.reportHTML != ``
+
+	withReports := reportsEnabled()
+	withFailedBullets := argv.dumpFailed != `` || argv.repro != `` || argv.coverage
+	var (
+		failures      []reportFailureRef
+		failedBullets = make(map[int]string) // индекс патрона -> вердикт
+		muFailures    sync.Mutex
+	)
 
 	var errorsAll int64
 
@@ -190,43 +404,57 @@ func benchServer() {
 			defer wg.Done()
 
 			var myErrors int64
+			myRoutes := make(map[string]*routeStat)
+			myParams := make(map[string]*paramStat)
+			var myFailures []reportFailureRef
+			myFailedBullets := make(map[int]string)
+			mySeries := make(map[timeSeriesKey]*timeSeriesBucket)
 
 			hideFailed := argv.hideFailed
 
-			for _, benchResult := range benchResultsAll[i] {
+			for j, benchResult := range benchResultsAll[i] {
 				bullet := bullets[benchResult.bulletIdx]
 
-				if benchResult.status != bullet.Response.Status {
-					if !hideFailed {
-						bodyReq, bodyRespGot, bodyRespExpect := getReqRespBodies(bullet, &benchResult)
-						fmt.Printf("REQUEST  URI: %s\nREQUEST BODY: %s\n", bullet.Request.URI, bodyReq)
-						fmt.Printf("STATUS GOT: %d \nSTATUS EXP: %d\n", benchResult.status, bullet.Response.Status)
-
-						if argv.bodyDiff {
-							dmp := diffmatchpatch.New()
-							diffs := dmp.DiffMain(string(bodyRespGot), string(bodyRespExpect), false)
-							fmt.Printf("BODIES DIFF: %s\n\n", dmp.DiffPrettyText(diffs))
-						} else {
-							fmt.Printf("BODY   GOT: %s\nBODY   EXP: %s\n\n", bodyRespGot, bodyRespExpect)
-						}
-
+				route, ok := myRoutes[bullet.Route]
+				if !ok {
+					route = &routeStat{}
+					myRoutes[bullet.Route] = route
+				}
+				route.queries++
+				route.dur += benchResult.dur
+				verdict, violations := resultVerdict(bullet, &benchResult)
+				if withReports {
+					route.durs = append(route.durs, benchResult.dur)
+					if route.verdicts == nil {
+						route.verdicts = make(map[string]int64)
 					}
+					route.verdicts[verdict]++
+				}
+				if verdict != verdictOK && !hideFailed {
+					printFailedBullet(bullet, &benchResult, verdict, violations)
+				}
+				if verdict == verdictInvariant {
+					invariants.add(violations)
+				}
+
+				failed := verdict != verdictOK
+				if failed {
 					myErrors++
-				} else if (bullet.Response.Status == 200) && !equalResponseBodies(benchResult.body, bullet.Response.Body) {
-					if !hideFailed {
-						bodyReq, bodyRespGot, bodyRespExpect := getReqRespBodies(bullet, &benchResult)
-						fmt.Printf("REQUEST  URI: %s\nREQUEST BODY: %s\n", bullet.Request.URI, bodyReq)
-
-						if argv.bodyDiff {
-							dmp := diffmatchpatch.New()
-							diffs := dmp.DiffMain(string(bodyRespGot), string(bodyRespExpect), false)
-							fmt.Printf("BODIES DIFF: %s\n\n", dmp.DiffPrettyText(diffs))
-						} else {
-							fmt.Printf("BODY   GOT: %s\nBODY   EXP: %s\n\n", bodyRespGot, bodyRespExpect)
-						}
+					route.failed++
+					if withReports {
+						myFailures = append(myFailures, reportFailureRef{benchResult.bulletIdx, &benchResultsAll[i][j], verdict})
 					}
-					myErrors++
+					if withFailedBullets {
+						myFailedBullets[benchResult.bulletIdx] = verdict
+					}
+				}
+				if argv.paramStats {
+					addParamStat(myParams, &bullet.Request, benchResult.dur, failed)
 				}
+				if withSeries {
+					series.add(mySeries, bullet.Route, &benchResult, verdict)
+				}
+
 				chtop <- &BenchTop{
 					req: bullet.Request.URI,
 					dur: benchResult.dur,
@@ -236,10 +464,23 @@ func benchServer() {
 			if myErrors > 0 {
 				atomic.AddInt64(&errorsAll, myErrors)
 			}
+			routes.merge(myRoutes)
+			params.merge(myParams)
+			series.merge(mySeries)
+
+			if len(myFailures) > 0 || len(myFailedBullets) > 0 {
+				muFailures.Lock()
+				failures = append(failures, myFailures...)
+				for bulletIdx, verdict := range myFailedBullets {
+					failedBullets[bulletIdx] = verdict
+				}
+				muFailures.Unlock()
+			}
 		}(i)
 	}
 
 	go func() {
+		defer close(chtopDone)
 		for bt := range chtop {
 			ln := len(benchtop)
 			idx := sort.Search(ln, func(i int) bool {
@@ -254,6 +495,7 @@ func benchServer() {
 
 	wg.Wait()
 	close(chtop)
+	<-chtopDone
 
 	if errorsAll == 0 {
 		fmt.Println(`All answers is OK`)
@@ -267,6 +509,87 @@ func benchServer() {
 			fmt.Printf("%s:%s\n", top.dur, top.req)
 		}
 	}
+	routes.print()
+	if argv.paramStats {
+		params.print()
+	}
+	invariants.print()
+	if argv.coverage {
+		printCoverage(bulletsCoverage(bullets, failedBullets))
+	}
+
+	if argv.timeSeries != `` {
+		if err := series.write(argv.timeSeries); err != nil {
+			log.Fatalln(errors.Wrap(err, `Cannot write time series`))
+		}
+		fmt.Println(`Time series written to`, argv.timeSeries)
+	}
+
+	if argv.dumpFailed != `` {
+		if err := dumpFailedBullets(argv.dumpFailed, failedBullets); err != nil {
+			log.Fatalln(errors.Wrap(err, `Cannot dump failed bullets`))
+		}
+	}
+	if argv.repro != `` {
+		if err := writeRepro(argv.repro, failedBullets); err != nil {
+			log.Fatalln(errors.Wrap(err, `Cannot write reproductions`))
+		}
+	}
+
+	if withReports {
+		report := buildRunReport(queries, errorsAll, time.Duration(mt)*time.Millisecond, routes, failures, benchtop[:])
+		if withSeries {
+			report.TimeSeries = series.rows()
+		}
+		if err := writeReports(report); err != nil {
+			log.Fatalln(errors.Wrap(err, `Cannot write report`))
+		}
+
+		var correctnessFailed, performanceFailed bool
+		if baseline != nil {
+			correctnessFailed, performanceFailed = compareBaseline(baseline, report)
+		}
+		if asserts != nil {
+			correctness, performance := checkAssertions(asserts, report)
+			correctnessFailed, performanceFailed = correctnessFailed || correctness, performanceFailed || performance
+		}
+
+		switch {
+		case correctnessFailed:
+			os.Exit(exitCodeCorrectness)
+		case performanceFailed:
+			os.Exit(exitCodePerformance)
+		}
+	}
+}
+
+// printFailedBullet печатает запрос и расхождение с ожидаемым ответом
+func printFailedBullet(bullet *Bullet, benchResult *BenchResult, verdict string, violations []invariantViolation) {
+	if verdict == verdictInvariant {
+		fmt.Printf("REQUEST  URI: %s\nINVARIANTS: %v\n\n", bullet.Request.URI, violations)
+		return
+	}
+
+	bodyReq, bodyRespGot, bodyRespExpect := getReqRespBodies(bullet, benchResult)
+	fmt.Printf("REQUEST  URI: %s\nREQUEST BODY: %s\n", bullet.Request.URI, bodyReq)
+	if verdict != verdictBody {
+		fmt.Printf("STATUS GOT: %d \nSTATUS EXP: %d\n", benchResult.status, bullet.Response.Status)
+	}
+
+	if argv.bodyDiff {
+		dmp := diffmatchpatch.New()
+		diffs := dmp.DiffMain(string(bodyRespGot), string(bodyRespExpect), false)
+		fmt.Printf("BODIES DIFF: %s\n\n", dmp.DiffPrettyText(diffs))
+	} else {
+		fmt.Printf("BODY   GOT: %s\nBODY   EXP: %s\n\n", bodyRespGot, bodyRespExpect)
+	}
+}
+
+func checkBulletInvariants(bullet *Bullet, benchResult *BenchResult) []invariantViolation {
+	if !argv.invariants {
+		return nil
+	}
+	return checkInvariants(&bullet.Request, benchResult.status, benchResult.body)
 }
 
 func getReqRespBodies(bullet *Bullet, benchResult *BenchResult) (bodyReq, bodyRespGot, bodyRespExpect []byte) {
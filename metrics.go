@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/valyala/fasthttp"
+)
+
+// Живые метрики прогона для Prometheus (-metrics-listen): запросы по маршруту, статусу и вердикту,
+// гистограмма задержек, запросы в полете и соединения. Формат text exposition пишется вручную, без клиента Prometheus.
+// Вердикт считает воркер (liveVerdict), горутина метрик только раскладывает результаты по счетчикам
+
+const (
+	metricsQueue  = 64 * 1024
+	metricsPrefix = `highloadcup_tester_`
+)
+
+type (
+	metricsKey struct {
+		route   string
+		status  int
+		verdict string
+	}
+
+	metricsLatency struct {
+		buckets []int64 // по latencyBucketsUs, последняя - +Inf
+		sum     time.Duration
+		count   int64
+	}
+
+	runMetrics struct {
+		results chan BenchResult
+		done    chan struct{}
+		ln      net.Listener
+
+		mu       sync.Mutex
+		requests map[metricsKey]int64
+		latency  map[string]*metricsLatency
+
+		inFlight   int64
+		connOpened int64
+		connClosed int64
+		dialErrors int64
+		bytesIn    int64
+		bytesOut   int64
+	}
+
+	metricsConn struct {
+		net.Conn
+		m    *runMetrics
+		once sync.Once
+	}
+)
+
+var (
+	// liveMetrics - метрики текущего прогона, nil если -metrics-listen не задан
+	liveMetrics *runMetrics
+
+	metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// openRunMetrics поднимает HTTP сервер /metrics на -metrics-listen и подключает счетчик соединений к client
+func openRunMetrics(client *fasthttp.Client) (*runMetrics, error) {
+	if argv.metricsListen == `` {
+		return nil, nil
+	}
+
+	ln, err := net.Listen(`tcp`, argv.metricsListen)
+	if err != nil {
+		return nil, errors.Wrap(err, `net.Listen`)
+	}
+
+	m := &runMetrics{
+		results:  make(chan BenchResult, metricsQueue),
+		done:     make(chan struct{}),
+		ln:       ln,
+		requests: make(map[metricsKey]int64),
+		latency:  make(map[string]*metricsLatency),
+	}
+
+	client.Dial = m.dial
+
+	server := &fasthttp.Server{Handler: m.handler}
+	go server.Serve(ln)
+	go m.loop()
+
+	fmt.Printf("Prometheus metrics on %s/metrics\n", argv.metricsListen)
+
+	return m, nil
+}
+
+// start отмечает отправку запроса. Безопасно для nil
+func (m *runMetrics) start() {
+	if m != nil {
+		atomic.AddInt64(&m.inFlight, 1)
+	}
+}
+
+// add учитывает завершенный запрос. Безопасно для nil
+func (m *runMetrics) add(result BenchResult) {
+	if m != nil {
+		atomic.AddInt64(&m.inFlight, -1)
+		m.results <- result
+	}
+}
+
+// Close дожидается учета всех результатов и останавливает сервер метрик
+func (m *runMetrics) Close() {
+	if m == nil {
+		return
+	}
+	close(m.results)
+	<-m.done
+	m.ln.Close()
+}
+
+func (m *runMetrics) loop() {
+	for result := range m.results {
+		bullet := bullets[result.bulletIdx]
+
+		m.mu.Lock()
+		m.requests[metricsKey{bullet.Route, result.status, result.verdict}]++
+		lat, ok := m.latency[bullet.Route]
+		if !ok {
+			lat = &metricsLatency{buckets: make([]int64, len(latencyBucketsUs)+1)}
+			m.latency[bullet.Route] = lat
+		}
+		us := int64(result.dur / time.Microsecond)
+		lat.buckets[sort.Search(len(latencyBucketsUs), func(i int) bool { return us <= latencyBucketsUs[i] })]++
+		lat.sum += result.dur
+		lat.count++
+		m.mu.Unlock()
+	}
+	close(m.done)
+}
+
+func (m *runMetrics) dial(addr string) (net.Conn, error) {
+	conn, err := fasthttp.Dial(addr)
+	if err != nil {
+		atomic.AddInt64(&m.dialErrors, 1)
+		return nil, err
+	}
+	atomic.AddInt64(&m.connOpened, 1)
+	return &metricsConn{Conn: conn, m: m}, nil
+}
+
+func (c *metricsConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.m.bytesIn, int64(n))
+	return n, err
+}
+
+func (c *metricsConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.m.bytesOut, int64(n))
+	return n, err
+}
+
+func (c *metricsConn) Close() error {
+	c.once.Do(func() { atomic.AddInt64(&c.m.connClosed, 1) })
+	return c.Conn.Close()
+}
+
+func (m *runMetrics) handler(ctx *fasthttp.RequestCtx) {
+	if string(ctx.Path()) != `/metrics` {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		return
+	}
+	ctx.SetContentType(`text/plain; version=0.0.4`)
+	ctx.SetBodyString(m.exposition())
+}
+
+// exposition возвращает метрики в текстовом формате Prometheus
+func (m *runMetrics) exposition() string {
+	var b strings.Builder
+
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %s%s %s\n# TYPE %s%s %s\n", metricsPrefix, name, help, metricsPrefix, name, kind)
+	}
+	label := func(value string) string {
+		return `"` + metricsLabelEscaper.Replace(value) + `"`
+	}
+
+	m.mu.Lock()
+	keys := make([]metricsKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		if keys[i].status != keys[j].status {
+			return keys[i].status < keys[j].status
+		}
+		return keys[i].verdict < keys[j].verdict
+	})
+
+	metric(`requests_total`, `counter`, `Requests by route, HTTP status (-1 for transport errors) and verdict.`)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%srequests_total{route=%s,status=\"%d\",verdict=%s} %d\n",
+			metricsPrefix, label(key.route), key.status, label(key.verdict), m.requests[key])
+	}
+
+	routes := make([]string, 0, len(m.latency))
+	for route := range m.latency {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	metric(`request_duration_seconds`, `histogram`, `Request latency by route.`)
+	for _, route := range routes {
+		lat := m.latency[route]
+		var cumulative int64
+		for i, count := range lat.buckets {
+			cumulative += count
+			le := `+Inf`
+			if i < len(latencyBucketsUs) {
+				le = strconv.FormatFloat(float64(latencyBucketsUs[i])/1e6, 'g', -1, 64)
+			}
+			fmt.Fprintf(&b, "%srequest_duration_seconds_bucket{route=%s,le=\"%s\"} %d\n", metricsPrefix, label(route), le, cumulative)
+		}
+		fmt.Fprintf(&b, "%srequest_duration_seconds_sum{route=%s} %g\n", metricsPrefix, label(route), lat.sum.Seconds())
+		fmt.Fprintf(&b, "%srequest_duration_seconds_count{route=%s} %d\n", metricsPrefix, label(route), lat.count)
+	}
+	m.mu.Unlock()
+
+	opened, closed := atomic.LoadInt64(&m.connOpened), atomic.LoadInt64(&m.connClosed)
+
+	metric(`requests_in_flight`, `gauge`, `Requests sent and not answered yet.`)
+	fmt.Fprintf(&b, "%srequests_in_flight %d\n", metricsPrefix, atomic.LoadInt64(&m.inFlight))
+	metric(`connections_opened_total`, `counter`, `Connections opened to the tested server.`)
+	fmt.Fprintf(&b, "%sconnections_opened_total %d\n", metricsPrefix, opened)
+	metric(`connections_open`, `gauge`, `Currently open connections to the tested server.`)
+	fmt.Fprintf(&b, "%sconnections_open %d\n", metricsPrefix, opened-closed)
+	metric(`dial_errors_total`, `counter`, `Failed connection attempts to the tested server.`)
+	fmt.Fprintf(&b, "%sdial_errors_total %d\n", metricsPrefix, atomic.LoadInt64(&m.dialErrors))
+	metric(`received_bytes_total`, `counter`, `Bytes received from the tested server.`)
+	fmt.Fprintf(&b, "%sreceived_bytes_total %d\n", metricsPrefix, atomic.LoadInt64(&m.bytesIn))
+	metric(`sent_bytes_total`, `counter`, `Bytes sent to the tested server.`)
+	fmt.Fprintf(&b, "%ssent_bytes_total %d\n", metricsPrefix, atomic.LoadInt64(&m.bytesOut))
+
+	return b.String()
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package main
+
+import (
+	"io/ioutil"
+)
+
+func mmapFile(fileName string) ([]byte, error) {
+	return ioutil.ReadFile(fileName)
+}
+
+func munmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,36 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile отображает файл в память только на чтение. Память не освобождается до конца работы, если не вызван munmapFile
+func mmapFile(fileName string) ([]byte, error) {
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	fi, err := fd.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		return nil, nil
+	}
+
+	return syscall.Mmap(int(fd.Fd()), 0, int(fi.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmapFile освобождает отображение, полученное от mmapFile
+func munmapFile(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Локальный оракул для API accounts 2018 года: загружает data.zip в память и сам вычисляет
+// ожидаемые ответы на /accounts/filter/, /group/, /<id>/recommend/ и /<id>/suggest/ по правилам контеста.
+// Все выборки - полным перебором, зато без риска разойтись с правилами из-за индексов
+
+const (
+	statusFree    = `свободны`
+	statusBusy    = `заняты`
+	statusComplex = `всё сложно`
+)
+
+var (
+	ErrOracleData = errors.New(`Cannot load oracle data`)
+
+	reOracleRoute = regexp.MustCompile(`^/accounts/(?:(filter|group)|(\d+)/(recommend|suggest)|([^/]+)/(?:recommend|suggest))/$`)
+
+	// приоритет статуса для recommend: чем меньше, тем лучше
+	statusRank = map[string]int{
+		statusFree:    0,
+		statusComplex: 1,
+		statusBusy:    2,
+	}
+)
+
+type (
+	oraclePremium struct {
+		Start  int64 `json:"start"`
+		Finish int64 `json:"finish"`
+	}
+
+	oracleLike struct {
+		ID int   `json:"id"`
+		Ts int64 `json:"ts"`
+	}
+
+	oracleAccount struct {
+		ID        int            `json:"id"`
+		Email     string         `json:"email"`
+		Fname     string         `json:"fname"`
+		Sname     string         `json:"sname"`
+		Phone     string         `json:"phone"`
+		Sex       string         `json:"sex"`
+		Birth     int64          `json:"birth"`
+		Country   string         `json:"country"`
+		City      string         `json:"city"`
+		Joined    int64          `json:"joined"`
+		Status    string         `json:"status"`
+		Interests []string       `json:"interests"`
+		Premium   *oraclePremium `json:"premium"`
+		Likes     []oracleLike   `json:"likes"`
+	}
+
+	oracleLiker struct {
+		ID int
+		Ts int64
+	}
+
+	oracleModel struct {
+		mu sync.RWMutex
+
+		now      int64
+		accounts map[int]*oracleAccount
+		sorted   []*oracleAccount // по убыванию id
+		likedBy  map[int][]oracleLiker
+		emails   map[string]int
+		phones   map[string]int
+	}
+
+	// oracleAccountJSON - аккаунт в ответе: null поля не выводятся
+	oracleAccountJSON struct {
+		ID      int            `json:"id"`
+		Email   string         `json:"email"`
+		Fname   string         `json:"fname,omitempty"`
+		Sname   string         `json:"sname,omitempty"`
+		Phone   string         `json:"phone,omitempty"`
+		Sex     string         `json:"sex,omitempty"`
+		Birth   *int64         `json:"birth,omitempty"`
+		Country string         `json:"country,omitempty"`
+		City    string         `json:"city,omitempty"`
+		Status  string         `json:"status,omitempty"`
+		Premium *oraclePremium `json:"premium,omitempty"`
+	}
+)
+
+// loadOracleModel загружает data.zip. dataPath - сам архив или каталог с data.zip и options.txt
+func loadOracleModel(dataPath string) (*oracleModel, error) {
+	zipFileName := dataPath
+	if fi, err := os.Stat(dataPath); err != nil {
+		return nil, errors.Wrap(err, `os.Stat`)
+	} else if fi.IsDir() {
+		zipFileName = path.Join(dataPath, `data.zip`)
+	}
+
+	zr, err := zip.OpenReader(zipFileName)
+	if err != nil {
+		return nil, errors.Wrap(err, `zip.OpenReader`)
+	}
+	defer zr.Close()
+
+	m := &oracleModel{
+		accounts: make(map[int]*oracleAccount),
+		likedBy:  make(map[int][]oracleLiker),
+		emails:   make(map[string]int),
+		phones:   make(map[string]int),
+	}
+
+	var options []byte
+	for _, file := range zr.File {
+		name := path.Base(file.Name)
+
+		switch {
+		case name == `options.txt`:
+			if options, err = readZipFile(file); err != nil {
+				return nil, err
+			}
+
+		case strings.HasPrefix(name, `accounts_`) && strings.HasSuffix(name, `.json`):
+			data, err := readZipFile(file)
+			if err != nil {
+				return nil, err
+			}
+
+			var chunk struct {
+				Accounts []*oracleAccount `json:"accounts"`
+			}
+			if err := json.Unmarshal(data, &chunk); err != nil {
+				return nil, errors.Wrap(ErrOracleData, fmt.Sprintf(`%s: %s`, file.Name, err))
+			}
+			for _, account := range chunk.Accounts {
+				m.accounts[account.ID] = account
+			}
+		}
+	}
+
+	if options == nil {
+		// в архивах контеста options.txt лежит рядом с data.zip
+		options, _ = ioutil.ReadFile(path.Join(path.Dir(zipFileName), `options.txt`))
+	}
+	if lines := strings.Fields(string(options)); len(lines) > 0 {
+		m.now, _ = strconv.ParseInt(lines[0], 10, 64)
+	}
+	if m.now == 0 {
+		m.now = time.Now().Unix()
+		fmt.Println(`...options.txt not found, current time is used for premium_now`)
+	}
+
+	if len(m.accounts) == 0 {
+		return nil, errors.Wrap(ErrOracleData, `no accounts_*.json in `+zipFileName)
+	}
+
+	for _, account := range m.accounts {
+		m.sorted = append(m.sorted, account)
+		m.emails[account.Email] = account.ID
+		if account.Phone != `` {
+			m.phones[account.Phone] = account.ID
+		}
+		for _, like := range account.Likes {
+			m.likedBy[like.ID] = append(m.likedBy[like.ID], oracleLiker{ID: account.ID, Ts: like.Ts})
+		}
+	}
+	sort.Slice(m.sorted, func(i, j int) bool {
+		return m.sorted[i].ID > m.sorted[j].ID
+	})
+
+	fmt.Printf("...oracle loaded %d accounts, now=%d\n", len(m.accounts), m.now)
+
+	return m, nil
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, errors.Wrap(err, file.Name)
+	}
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(rc)
+	return data, errors.Wrap(err, file.Name)
+}
+
+// loadOracleBullets загружает патроны и вычисляет ответы на них оракулом вместо файла ответов
+func loadOracleBullets(ammoFileName string) ([]*Bullet, error) {
+	model, err := loadOracleModel(argv.oracle)
+	if err != nil {
+		return nil, err
+	}
+
+	applyFileNames, err := oracleApplyFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, applyFileName := range applyFileNames {
+		if err := model.apply(applyFileName); err != nil {
+			return nil, err
+		}
+	}
+
+	oracleBullets, err := loadAmmo(ammoFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	model.answerAll(oracleBullets)
+
+	return oracleBullets, nil
+}
+
+// oracleApplyFiles возвращает патроны, которые нужно применить к модели до вычисления ответов:
+// заданные в -oracle-apply, либо все пишущие фазы hlcupdocs до текущей
+func oracleApplyFiles() ([]string, error) {
+	if argv.oracleApply != `` {
+		return strings.Split(argv.oracleApply, `,`), nil
+	}
+
+	if phase == nil || phase.Num == 0 {
+		return nil, nil
+	}
+
+	phases, err := discoverPhases(argv.hlcupdocsPath)
+	if err != nil {
+		return nil, errors.Wrap(err, `!discoverPhases`)
+	}
+
+	var fileNames []string
+	for _, p := range phases {
+		if p.Num < phase.Num && p.IsWrite() {
+			fileNames = append(fileNames, p.AmmoFile)
+		}
+	}
+	return fileNames, nil
+}
+
+// apply прогоняет через модель изменяющие запросы из файла патронов
+func (m *oracleModel) apply(ammoFileName string) error {
+	applyBullets, err := loadAmmo(ammoFileName)
+	if err != nil {
+		return err
+	}
+
+	statuses := make(map[int]int)
+	for _, bullet := range applyBullets {
+		if !bullet.Request.IsGet {
+			statuses[m.answer(&bullet.Request).Status]++
+		}
+	}
+
+	fmt.Printf("...oracle applied %s: %v\n", ammoFileName, statuses)
+
+	return nil
+}
+
+// answerAll вычисляет ответы на все патроны. GET запросы не меняют модель, поэтому считаются параллельно
+func (m *oracleModel) answerAll(oracleBullets []*Bullet) {
+	wg := &sync.WaitGroup{}
+	sem := make(chan struct{}, runtime.NumCPU())
+
+	for _, bullet := range oracleBullets {
+		if !bullet.Request.IsGet {
+			wg.Wait()
+			bullet.Response = m.answer(&bullet.Request)
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(bullet *Bullet) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			bullet.Response = m.answer(&bullet.Request)
+		}(bullet)
+	}
+
+	wg.Wait()
+}
+
+func (m *oracleModel) answer(request *Request) Response {
+	uri, err := url.ParseRequestURI(string(request.URI))
+	if err != nil {
+		return Response{Status: 400}
+	}
+
+	query, err := url.ParseQuery(uri.RawQuery)
+	if err != nil {
+		return Response{Status: 400}
+	}
+
+	match := reOracleRoute.FindStringSubmatch(uri.Path)
+	if len(match) == 0 || !request.IsGet {
+		return m.answerPost(request, uri.Path, query)
+	}
+
+	if match[4] != `` {
+		// /accounts/abc/recommend/ - такого аккаунта быть не может
+		return Response{Status: 404}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	switch {
+	case match[1] == `filter`:
+		return m.filter(query)
+	case match[1] == `group`:
+		return m.group(query)
+	default:
+		id, _ := strconv.Atoi(match[2])
+		if match[3] == `recommend` {
+			return m.recommend(id, query)
+		}
+		return m.suggest(id, query)
+	}
+}
+
+func (m *oracleModel) premiumNow(account *oracleAccount) bool {
+	return account.Premium != nil && account.Premium.Start <= m.now && m.now < account.Premium.Finish
+}
+
+func oracleJSON(status int, v interface{}) Response {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic(errors.Wrap(err, `json.Marshal`))
+	}
+	return Response{Status: status, Body: body}
+}
+
+func oracleAccountsResponse(accounts []oracleAccountJSON) Response {
+	if accounts == nil {
+		accounts = []oracleAccountJSON{}
+	}
+	return oracleJSON(200, struct {
+		Accounts []oracleAccountJSON `json:"accounts"`
+	}{accounts})
+}
+
+// oracleLimit разбирает обязательный limit: целое больше нуля
+func oracleLimit(query url.Values) (int, bool) {
+	limit, err := strconv.Atoi(query.Get(`limit`))
+	return limit, err == nil && limit > 0
+}
+
+func yearOf(ts int64) int {
+	return time.Unix(ts, 0).UTC().Year()
+}
+
+func phoneCode(phone string) string {
+	start := strings.IndexByte(phone, '(')
+	end := strings.IndexByte(phone, ')')
+	if start < 0 || end < start {
+		return ``
+	}
+	return phone[start+1 : end]
+}
+
+func emailDomain(email string) string {
+	if pos := strings.IndexByte(email, '@'); pos >= 0 {
+		return email[pos+1:]
+	}
+	return ``
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func splitOracleList(value string) []string {
+	return strings.Split(value, `,`)
+}
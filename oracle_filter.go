@@ -0,0 +1,454 @@
+package main
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	// oraclePredicate проверяет аккаунт; fields - какие поля аккаунта попадают в ответ /filter/
+	oraclePredicate struct {
+		match  func(account *oracleAccount) bool
+		fields []string
+	}
+
+	oracleGroup struct {
+		values []string // по ключам из keys, пустая строка - null
+		count  int
+	}
+)
+
+var (
+	oracleGroupKeys = map[string]bool{
+		`sex`:       true,
+		`status`:    true,
+		`interests`: true,
+		`country`:   true,
+		`city`:      true,
+	}
+)
+
+// filter реализует /accounts/filter/
+func (m *oracleModel) filter(query url.Values) Response {
+	limit, ok := oracleLimit(query)
+	if !ok {
+		return Response{Status: 400}
+	}
+
+	var predicates []oraclePredicate
+	for param, values := range query {
+		if param == `limit` || param == `query_id` {
+			continue
+		}
+
+		predicate, ok := m.filterPredicate(param, values[0])
+		if !ok {
+			return Response{Status: 400}
+		}
+		predicates = append(predicates, predicate)
+	}
+
+	var found []oracleAccountJSON
+	for _, account := range m.sorted {
+		if !matchAll(predicates, account) {
+			continue
+		}
+
+		result := oracleAccountJSON{ID: account.ID, Email: account.Email}
+		for _, predicate := range predicates {
+			for _, field := range predicate.fields {
+				setOracleField(&result, account, field)
+			}
+		}
+		found = append(found, result)
+
+		if len(found) >= limit {
+			break
+		}
+	}
+
+	return oracleAccountsResponse(found)
+}
+
+func matchAll(predicates []oraclePredicate, account *oracleAccount) bool {
+	for _, predicate := range predicates {
+		if !predicate.match(account) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *oracleModel) filterPredicate(param, value string) (p oraclePredicate, ok bool) {
+	if value == `` {
+		return p, false
+	}
+
+	pos := strings.LastIndexByte(param, '_')
+	if pos <= 0 {
+		return p, false
+	}
+	field, op := param[:pos], param[pos+1:]
+
+	if op == `null` {
+		if value != `0` && value != `1` {
+			return p, false
+		}
+		isNull := value == `1`
+
+		var get func(account *oracleAccount) bool
+		switch field {
+		case `fname`:
+			get = func(a *oracleAccount) bool { return a.Fname == `` }
+		case `sname`:
+			get = func(a *oracleAccount) bool { return a.Sname == `` }
+		case `phone`:
+			get = func(a *oracleAccount) bool { return a.Phone == `` }
+		case `country`:
+			get = func(a *oracleAccount) bool { return a.Country == `` }
+		case `city`:
+			get = func(a *oracleAccount) bool { return a.City == `` }
+		case `premium`:
+			get = func(a *oracleAccount) bool { return a.Premium == nil }
+		default:
+			return p, false
+		}
+
+		return oraclePredicate{
+			match:  func(a *oracleAccount) bool { return get(a) == isNull },
+			fields: []string{field},
+		}, true
+	}
+
+	p.fields = []string{field}
+
+	switch param {
+	case `sex_eq`:
+		if value != `m` && value != `f` {
+			return p, false
+		}
+		p.match = func(a *oracleAccount) bool { return a.Sex == value }
+
+	case `email_domain`:
+		p.fields = nil
+		p.match = func(a *oracleAccount) bool { return emailDomain(a.Email) == value }
+	case `email_lt`:
+		p.fields = nil
+		p.match = func(a *oracleAccount) bool { return a.Email < value }
+	case `email_gt`:
+		p.fields = nil
+		p.match = func(a *oracleAccount) bool { return a.Email > value }
+
+	case `status_eq`, `status_neq`:
+		if _, ok := statusRank[value]; !ok {
+			return p, false
+		}
+		eq := op == `eq`
+		p.match = func(a *oracleAccount) bool { return (a.Status == value) == eq }
+
+	case `fname_eq`:
+		p.match = func(a *oracleAccount) bool { return a.Fname == value }
+	case `fname_any`:
+		names := splitOracleList(value)
+		p.match = func(a *oracleAccount) bool { return a.Fname != `` && containsString(names, a.Fname) }
+
+	case `sname_eq`:
+		p.match = func(a *oracleAccount) bool { return a.Sname == value }
+	case `sname_starts`:
+		p.match = func(a *oracleAccount) bool { return a.Sname != `` && strings.HasPrefix(a.Sname, value) }
+
+	case `phone_code`:
+		p.match = func(a *oracleAccount) bool { return a.Phone != `` && phoneCode(a.Phone) == value }
+
+	case `country_eq`:
+		p.match = func(a *oracleAccount) bool { return a.Country == value }
+
+	case `city_eq`:
+		p.match = func(a *oracleAccount) bool { return a.City == value }
+	case `city_any`:
+		cities := splitOracleList(value)
+		p.match = func(a *oracleAccount) bool { return a.City != `` && containsString(cities, a.City) }
+
+	case `birth_lt`, `birth_gt`:
+		ts, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return p, false
+		}
+		lt := op == `lt`
+		p.match = func(a *oracleAccount) bool { return (lt && a.Birth < ts) || (!lt && a.Birth > ts) }
+	case `birth_year`:
+		year, err := strconv.Atoi(value)
+		if err != nil {
+			return p, false
+		}
+		p.match = func(a *oracleAccount) bool { return yearOf(a.Birth) == year }
+
+	case `interests_contains`:
+		p.fields = nil
+		interests := splitOracleList(value)
+		p.match = func(a *oracleAccount) bool {
+			for _, interest := range interests {
+				if !containsString(a.Interests, interest) {
+					return false
+				}
+			}
+			return true
+		}
+	case `interests_any`:
+		p.fields = nil
+		interests := splitOracleList(value)
+		p.match = func(a *oracleAccount) bool {
+			for _, interest := range interests {
+				if containsString(a.Interests, interest) {
+					return true
+				}
+			}
+			return false
+		}
+
+	case `likes_contains`:
+		p.fields = nil
+		var ids []int
+		for _, s := range splitOracleList(value) {
+			id, err := strconv.Atoi(s)
+			if err != nil {
+				return p, false
+			}
+			ids = append(ids, id)
+		}
+		p.match = func(a *oracleAccount) bool {
+			for _, id := range ids {
+				if !accountLikes(a, id) {
+					return false
+				}
+			}
+			return true
+		}
+
+	case `premium_now`:
+		if value != `1` {
+			return p, false
+		}
+		p.fields = []string{`premium`}
+		p.match = m.premiumNow
+
+	default:
+		return p, false
+	}
+
+	return p, true
+}
+
+func accountLikes(account *oracleAccount, id int) bool {
+	for _, like := range account.Likes {
+		if like.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func setOracleField(result *oracleAccountJSON, account *oracleAccount, field string) {
+	switch field {
+	case `sex`:
+		result.Sex = account.Sex
+	case `status`:
+		result.Status = account.Status
+	case `fname`:
+		result.Fname = account.Fname
+	case `sname`:
+		result.Sname = account.Sname
+	case `phone`:
+		result.Phone = account.Phone
+	case `country`:
+		result.Country = account.Country
+	case `city`:
+		result.City = account.City
+	case `birth`:
+		birth := account.Birth
+		result.Birth = &birth
+	case `premium`:
+		result.Premium = account.Premium
+	}
+}
+
+// group реализует /accounts/group/
+func (m *oracleModel) group(query url.Values) Response {
+	limit, ok := oracleLimit(query)
+	if !ok {
+		return Response{Status: 400}
+	}
+
+	order := query.Get(`order`)
+	if order != `1` && order != `-1` {
+		return Response{Status: 400}
+	}
+
+	keysValue := query.Get(`keys`)
+	if keysValue == `` {
+		return Response{Status: 400}
+	}
+	keys := splitOracleList(keysValue)
+	for _, key := range keys {
+		if !oracleGroupKeys[key] {
+			return Response{Status: 400}
+		}
+	}
+
+	var predicates []oraclePredicate
+	for param, values := range query {
+		switch param {
+		case `limit`, `query_id`, `order`, `keys`:
+			continue
+		}
+
+		predicate, ok := m.groupPredicate(param, values[0])
+		if !ok {
+			return Response{Status: 400}
+		}
+		predicates = append(predicates, predicate)
+	}
+
+	groups := make(map[string]*oracleGroup)
+	values := make([]string, len(keys))
+
+	var addGroup func(account *oracleAccount, keyIdx int)
+	addGroup = func(account *oracleAccount, keyIdx int) {
+		if keyIdx == len(keys) {
+			id := strings.Join(values, "\x00")
+			if g, ok := groups[id]; ok {
+				g.count++
+			} else {
+				groups[id] = &oracleGroup{values: append([]string{}, values...), count: 1}
+			}
+			return
+		}
+
+		if keys[keyIdx] == `interests` {
+			// каждый интерес аккаунта - отдельная группа
+			for _, interest := range account.Interests {
+				values[keyIdx] = interest
+				addGroup(account, keyIdx+1)
+			}
+			return
+		}
+
+		values[keyIdx] = groupKeyValue(account, keys[keyIdx])
+		addGroup(account, keyIdx+1)
+	}
+
+	for _, account := range m.sorted {
+		if matchAll(predicates, account) {
+			addGroup(account, 0)
+		}
+	}
+
+	sorted := make([]*oracleGroup, 0, len(groups))
+	for _, g := range groups {
+		sorted = append(sorted, g)
+	}
+
+	asc := order == `1`
+	sort.Slice(sorted, func(i, j int) bool {
+		less := false
+		if sorted[i].count != sorted[j].count {
+			less = sorted[i].count < sorted[j].count
+		} else {
+			for k := range keys {
+				if sorted[i].values[k] != sorted[j].values[k] {
+					less = sorted[i].values[k] < sorted[j].values[k]
+					break
+				}
+			}
+		}
+		if asc {
+			return less
+		}
+		return !less && !equalGroups(sorted[i], sorted[j])
+	})
+
+	if len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+
+	result := make([]map[string]interface{}, 0, len(sorted))
+	for _, g := range sorted {
+		item := map[string]interface{}{`count`: g.count}
+		for k, key := range keys {
+			if g.values[k] != `` {
+				item[key] = g.values[k]
+			}
+		}
+		result = append(result, item)
+	}
+
+	return oracleJSON(200, struct {
+		Groups []map[string]interface{} `json:"groups"`
+	}{result})
+}
+
+func equalGroups(a, b *oracleGroup) bool {
+	if a.count != b.count {
+		return false
+	}
+	for k := range a.values {
+		if a.values[k] != b.values[k] {
+			return false
+		}
+	}
+	return true
+}
+
+func groupKeyValue(account *oracleAccount, key string) string {
+	switch key {
+	case `sex`:
+		return account.Sex
+	case `status`:
+		return account.Status
+	case `country`:
+		return account.Country
+	case `city`:
+		return account.City
+	}
+	return ``
+}
+
+// groupPredicate - фильтры /group/ задаются точным значением поля
+func (m *oracleModel) groupPredicate(param, value string) (p oraclePredicate, ok bool) {
+	if value == `` {
+		return p, false
+	}
+
+	switch param {
+	case `sex`, `status`, `fname`, `sname`, `country`, `city`:
+		return m.filterPredicate(param+`_eq`, value)
+
+	case `birth`, `joined`:
+		year, err := strconv.Atoi(value)
+		if err != nil {
+			return p, false
+		}
+		if param == `birth` {
+			p.match = func(a *oracleAccount) bool { return yearOf(a.Birth) == year }
+		} else {
+			p.match = func(a *oracleAccount) bool { return yearOf(a.Joined) == year }
+		}
+
+	case `interests`:
+		p.match = func(a *oracleAccount) bool { return containsString(a.Interests, value) }
+
+	case `likes`:
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return p, false
+		}
+		p.match = func(a *oracleAccount) bool { return accountLikes(a, id) }
+
+	default:
+		return p, false
+	}
+
+	return p, true
+}
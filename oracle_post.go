@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Изменяющие запросы фазы 2: оракул проверяет их по правилам контеста и применяет к модели,
+// чтобы ответы фазы 3 считались уже по измененным данным
+
+var (
+	reOraclePostRoute = regexp.MustCompile(`^/accounts/(new|likes|[^/]+)/$`)
+	reOracleEmail     = regexp.MustCompile(`^[^@\s]+@[^@\s]+$`)
+	reOraclePhone     = regexp.MustCompile(`^8\(\d{3}\)\d{7}$`)
+
+	oracleResponseOK = []byte(`{}`)
+)
+
+func (m *oracleModel) answerPost(request *Request, uriPath string, query url.Values) Response {
+	match := reOraclePostRoute.FindStringSubmatch(uriPath)
+	if request.IsGet || len(match) == 0 {
+		return Response{Status: 404}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch match[1] {
+	case `new`:
+		return m.newAccount(request.Body)
+	case `likes`:
+		return m.addLikes(request.Body)
+	default:
+		id, err := strconv.Atoi(match[1])
+		if err != nil {
+			return Response{Status: 404}
+		}
+		return m.updateAccount(id, request.Body)
+	}
+}
+
+// newAccount реализует POST /accounts/new/
+func (m *oracleModel) newAccount(body []byte) Response {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return Response{Status: 400}
+	}
+
+	for _, required := range []string{`id`, `email`, `sex`, `birth`, `joined`, `status`} {
+		if _, ok := fields[required]; !ok {
+			return Response{Status: 400}
+		}
+	}
+
+	account := &oracleAccount{}
+	if !m.setAccountFields(account, fields) {
+		return Response{Status: 400}
+	}
+	if _, exists := m.accounts[account.ID]; exists || account.ID <= 0 {
+		return Response{Status: 400}
+	}
+
+	m.accounts[account.ID] = account
+	pos := sort.Search(len(m.sorted), func(i int) bool { return m.sorted[i].ID < account.ID })
+	m.sorted = append(m.sorted, nil)
+	copy(m.sorted[pos+1:], m.sorted[pos:])
+	m.sorted[pos] = account
+
+	m.indexAccount(account)
+
+	return Response{Status: 201, Body: oracleResponseOK}
+}
+
+// updateAccount реализует POST /accounts/<id>/
+func (m *oracleModel) updateAccount(id int, body []byte) Response {
+	account, ok := m.accounts[id]
+	if !ok {
+		return Response{Status: 404}
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return Response{Status: 400}
+	}
+	if _, ok := fields[`id`]; ok {
+		return Response{Status: 400}
+	}
+
+	updated := *account
+	if !m.setAccountFields(&updated, fields) {
+		return Response{Status: 400}
+	}
+
+	m.unindexAccount(account)
+	*account = updated
+	m.indexAccount(account)
+
+	return Response{Status: 202, Body: oracleResponseOK}
+}
+
+// addLikes реализует POST /accounts/likes/: либо применяются все лайки, либо ни одного
+func (m *oracleModel) addLikes(body []byte) Response {
+	var likes struct {
+		Likes []map[string]json.RawMessage `json:"likes"`
+	}
+	if err := json.Unmarshal(body, &likes); err != nil || likes.Likes == nil {
+		return Response{Status: 400}
+	}
+
+	type newLike struct {
+		liker, likee int
+		ts           int64
+	}
+
+	var parsed []newLike
+	for _, like := range likes.Likes {
+		var l newLike
+		var liker, likee, ts int64
+		if !oracleInt(like[`liker`], &liker) || !oracleInt(like[`likee`], &likee) || !oracleInt(like[`ts`], &ts) {
+			return Response{Status: 400}
+		}
+		l.liker, l.likee, l.ts = int(liker), int(likee), ts
+
+		if _, ok := m.accounts[l.liker]; !ok {
+			return Response{Status: 400}
+		}
+		if _, ok := m.accounts[l.likee]; !ok {
+			return Response{Status: 400}
+		}
+		parsed = append(parsed, l)
+	}
+
+	for _, l := range parsed {
+		account := m.accounts[l.liker]
+		account.Likes = append(account.Likes, oracleLike{ID: l.likee, Ts: l.ts})
+		m.likedBy[l.likee] = append(m.likedBy[l.likee], oracleLiker{ID: l.liker, Ts: l.ts})
+	}
+
+	return Response{Status: 202, Body: oracleResponseOK}
+}
+
+// setAccountFields проверяет и переносит поля из тела запроса. null и значения не того типа - ошибка
+func (m *oracleModel) setAccountFields(account *oracleAccount, fields map[string]json.RawMessage) bool {
+	for key, raw := range fields {
+		var ok bool
+
+		switch key {
+		case `id`:
+			var id int64
+			ok = oracleInt(raw, &id)
+			account.ID = int(id)
+
+		case `email`:
+			ok = oracleString(raw, &account.Email) && reOracleEmail.MatchString(account.Email)
+			if owner, exists := m.emails[account.Email]; exists && owner != account.ID {
+				ok = false
+			}
+
+		case `phone`:
+			ok = oracleString(raw, &account.Phone) && reOraclePhone.MatchString(account.Phone)
+			if owner, exists := m.phones[account.Phone]; exists && owner != account.ID {
+				ok = false
+			}
+
+		case `fname`:
+			ok = oracleString(raw, &account.Fname)
+		case `sname`:
+			ok = oracleString(raw, &account.Sname)
+		case `country`:
+			ok = oracleString(raw, &account.Country)
+		case `city`:
+			ok = oracleString(raw, &account.City)
+
+		case `sex`:
+			ok = oracleString(raw, &account.Sex) && (account.Sex == `m` || account.Sex == `f`)
+
+		case `status`:
+			ok = oracleString(raw, &account.Status)
+			if _, known := statusRank[account.Status]; !known {
+				ok = false
+			}
+
+		case `birth`:
+			ok = oracleInt(raw, &account.Birth)
+		case `joined`:
+			ok = oracleInt(raw, &account.Joined)
+
+		case `interests`:
+			var interests []string
+			ok = json.Unmarshal(raw, &interests) == nil && interests != nil
+			account.Interests = interests
+
+		case `premium`:
+			var premium map[string]json.RawMessage
+			if json.Unmarshal(raw, &premium) == nil && premium != nil {
+				var p oraclePremium
+				ok = oracleInt(premium[`start`], &p.Start) && oracleInt(premium[`finish`], &p.Finish)
+				account.Premium = &p
+			}
+
+		case `likes`:
+			var likes []map[string]json.RawMessage
+			if json.Unmarshal(raw, &likes) == nil && likes != nil {
+				ok = true
+				account.Likes = nil
+				for _, like := range likes {
+					var id, ts int64
+					if !oracleInt(like[`id`], &id) || !oracleInt(like[`ts`], &ts) {
+						ok = false
+						break
+					}
+					if _, exists := m.accounts[int(id)]; !exists {
+						ok = false
+						break
+					}
+					account.Likes = append(account.Likes, oracleLike{ID: int(id), Ts: ts})
+				}
+			}
+
+		default:
+			ok = false
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (m *oracleModel) indexAccount(account *oracleAccount) {
+	m.emails[account.Email] = account.ID
+	if account.Phone != `` {
+		m.phones[account.Phone] = account.ID
+	}
+	for _, like := range account.Likes {
+		m.likedBy[like.ID] = append(m.likedBy[like.ID], oracleLiker{ID: account.ID, Ts: like.Ts})
+	}
+}
+
+func (m *oracleModel) unindexAccount(account *oracleAccount) {
+	delete(m.emails, account.Email)
+	if account.Phone != `` {
+		delete(m.phones, account.Phone)
+	}
+	for _, like := range account.Likes {
+		likers := m.likedBy[like.ID]
+		for i, liker := range likers {
+			if liker.ID == account.ID && liker.Ts == like.Ts {
+				m.likedBy[like.ID] = append(likers[:i], likers[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func oracleString(raw json.RawMessage, dst *string) bool {
+	return len(raw) > 0 && raw[0] == '"' && json.Unmarshal(raw, dst) == nil
+}
+
+func oracleInt(raw json.RawMessage, dst *int64) bool {
+	if len(raw) == 0 || strings.ContainsAny(string(raw), `."eE`) {
+		return false
+	}
+	v, err := strconv.ParseInt(string(raw), 10, 64)
+	*dst = v
+	return err == nil
+}
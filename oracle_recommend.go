@@ -0,0 +1,228 @@
+package main
+
+import (
+	"net/url"
+	"sort"
+)
+
+// oracleLocationFilter разбирает необязательные country/city у recommend и suggest
+func oracleLocationFilter(query url.Values) (func(account *oracleAccount) bool, bool) {
+	for param, values := range query {
+		switch param {
+		case `limit`, `query_id`:
+		case `country`, `city`:
+			if values[0] == `` {
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+	}
+
+	_, withCountry := query[`country`]
+	_, withCity := query[`city`]
+	country, city := query.Get(`country`), query.Get(`city`)
+
+	return func(account *oracleAccount) bool {
+		return (!withCountry || account.Country == country) && (!withCity || account.City == city)
+	}, true
+}
+
+// recommend реализует /accounts/<id>/recommend/: противоположный пол и хотя бы один общий интерес.
+// Порядок: премиум сейчас, статус (свободны, всё сложно, заняты), число общих интересов, близость возраста, id
+func (m *oracleModel) recommend(id int, query url.Values) Response {
+	me, ok := m.accounts[id]
+	if !ok {
+		return Response{Status: 404}
+	}
+
+	limit, ok := oracleLimit(query)
+	if !ok {
+		return Response{Status: 400}
+	}
+	location, ok := oracleLocationFilter(query)
+	if !ok {
+		return Response{Status: 400}
+	}
+
+	type candidate struct {
+		account   *oracleAccount
+		premium   bool
+		common    int
+		birthDiff int64
+	}
+
+	var candidates []candidate
+	for _, account := range m.sorted {
+		if account.Sex == me.Sex || !location(account) {
+			continue
+		}
+
+		common := 0
+		for _, interest := range account.Interests {
+			if containsString(me.Interests, interest) {
+				common++
+			}
+		}
+		if common == 0 {
+			continue
+		}
+
+		birthDiff := account.Birth - me.Birth
+		if birthDiff < 0 {
+			birthDiff = -birthDiff
+		}
+
+		candidates = append(candidates, candidate{
+			account:   account,
+			premium:   m.premiumNow(account),
+			common:    common,
+			birthDiff: birthDiff,
+		})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := &candidates[i], &candidates[j]
+		if a.premium != b.premium {
+			return a.premium
+		}
+		if ra, rb := statusRank[a.account.Status], statusRank[b.account.Status]; ra != rb {
+			return ra < rb
+		}
+		if a.common != b.common {
+			return a.common > b.common
+		}
+		if a.birthDiff != b.birthDiff {
+			return a.birthDiff < b.birthDiff
+		}
+		return a.account.ID < b.account.ID
+	})
+
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	var found []oracleAccountJSON
+	for _, c := range candidates {
+		birth := c.account.Birth
+		found = append(found, oracleAccountJSON{
+			ID:      c.account.ID,
+			Email:   c.account.Email,
+			Status:  c.account.Status,
+			Fname:   c.account.Fname,
+			Sname:   c.account.Sname,
+			Birth:   &birth,
+			Premium: c.account.Premium,
+		})
+	}
+
+	return oracleAccountsResponse(found)
+}
+
+// suggest реализует /accounts/<id>/suggest/: похожесть - сумма 1/|ts1-ts2| по общим лайкам
+// (для повторных лайков берется среднее ts). Из самых похожих берутся те, кого я еще не лайкал, по убыванию id
+func (m *oracleModel) suggest(id int, query url.Values) Response {
+	me, ok := m.accounts[id]
+	if !ok {
+		return Response{Status: 404}
+	}
+
+	limit, ok := oracleLimit(query)
+	if !ok {
+		return Response{Status: 400}
+	}
+	location, ok := oracleLocationFilter(query)
+	if !ok {
+		return Response{Status: 400}
+	}
+
+	myLikes := averageLikes(me.Likes)
+
+	similarity := make(map[int]float64)
+	for likee, myTs := range myLikes {
+		likers := make(map[int][]int64)
+		for _, liker := range m.likedBy[likee] {
+			if liker.ID != me.ID {
+				likers[liker.ID] = append(likers[liker.ID], liker.Ts)
+			}
+		}
+
+		for likerID, tss := range likers {
+			var sum int64
+			for _, ts := range tss {
+				sum += ts
+			}
+			diff := myTs - float64(sum)/float64(len(tss))
+			if diff < 0 {
+				diff = -diff
+			}
+			if diff == 0 {
+				similarity[likerID] += 1
+			} else {
+				similarity[likerID] += 1 / diff
+			}
+		}
+	}
+
+	var similar []*oracleAccount
+	for similarID := range similarity {
+		if account, ok := m.accounts[similarID]; ok && location(account) {
+			similar = append(similar, account)
+		}
+	}
+	sort.Slice(similar, func(i, j int) bool {
+		si, sj := similarity[similar[i].ID], similarity[similar[j].ID]
+		if si != sj {
+			return si > sj
+		}
+		return similar[i].ID > similar[j].ID
+	})
+
+	seen := make(map[int]bool)
+	var found []oracleAccountJSON
+	for _, account := range similar {
+		var ids []int
+		for _, like := range account.Likes {
+			if _, liked := myLikes[like.ID]; !liked && like.ID != me.ID && !seen[like.ID] {
+				ids = append(ids, like.ID)
+				seen[like.ID] = true
+			}
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+
+		for _, likeID := range ids {
+			suggested, ok := m.accounts[likeID]
+			if !ok {
+				continue
+			}
+			found = append(found, oracleAccountJSON{
+				ID:     suggested.ID,
+				Email:  suggested.Email,
+				Status: suggested.Status,
+				Fname:  suggested.Fname,
+				Sname:  suggested.Sname,
+			})
+			if len(found) >= limit {
+				return oracleAccountsResponse(found)
+			}
+		}
+	}
+
+	return oracleAccountsResponse(found)
+}
+
+// averageLikes сворачивает повторные лайки одного аккаунта в среднее ts
+func averageLikes(likes []oracleLike) map[int]float64 {
+	sums := make(map[int]int64)
+	counts := make(map[int]int64)
+	for _, like := range likes {
+		sums[like.ID] += like.Ts
+		counts[like.ID]++
+	}
+
+	avg := make(map[int]float64, len(sums))
+	for id, sum := range sums {
+		avg[id] = float64(sum) / float64(counts[id])
+	}
+	return avg
+}
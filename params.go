@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Разбивка ошибок и задержек /filter/ и /group/ по параметрам запроса и их сочетаниям:
+// позволяет увидеть, какой именно предикат сломан или медленный
+
+const (
+	paramStatsTop = 10
+	// в рейтинг по p99 попадают параметры хотя бы с таким числом запросов, иначе наверху одиночные сочетания
+	paramStatsMinQueries = 10
+)
+
+type (
+	paramStat struct {
+		queries, failed int64
+		durs            []time.Duration
+	}
+
+	paramStats struct {
+		mu    sync.Mutex
+		stats map[string]*paramStat
+	}
+)
+
+// bulletParams возвращает параметры запроса /filter/ или /group/ без limit и query_id, а также их сочетание.
+// Для keys и order учитывается значение, потому что ломаются обычно конкретные ключи группировки и направление.
+// order есть в каждом /group/, поэтому в сочетания не входит
+func bulletParams(request *Request) []string {
+	uri, err := url.ParseRequestURI(string(request.URI))
+	if err != nil || !request.IsGet || (uri.Path != `/accounts/filter/` && uri.Path != `/accounts/group/`) {
+		return nil
+	}
+
+	query, err := url.ParseQuery(uri.RawQuery)
+	if err != nil {
+		return nil
+	}
+
+	var params []string
+	order := ``
+	for param, values := range query {
+		switch param {
+		case `limit`, `query_id`:
+		case `order`:
+			order = `order=` + values[0]
+		case `keys`:
+			params = append(params, `keys=`+values[0])
+		default:
+			params = append(params, param)
+		}
+	}
+	sort.Strings(params)
+
+	if len(params) > 1 {
+		params = append(params, strings.Join(params, `+`))
+	}
+	if order != `` {
+		params = append(params, order)
+	}
+	return params
+}
+
+func newParamStats() *paramStats {
+	return &paramStats{stats: make(map[string]*paramStat)}
+}
+
+func addParamStat(my map[string]*paramStat, request *Request, dur time.Duration, failed bool) {
+	for _, param := range bulletParams(request) {
+		stat, ok := my[param]
+		if !ok {
+			stat = &paramStat{}
+			my[param] = stat
+		}
+		stat.queries++
+		stat.durs = append(stat.durs, dur)
+		if failed {
+			stat.failed++
+		}
+	}
+}
+
+func (ps *paramStats) merge(my map[string]*paramStat) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	for param, stat := range my {
+		if total, ok := ps.stats[param]; !ok {
+			ps.stats[param] = stat
+		} else {
+			total.queries += stat.queries
+			total.failed += stat.failed
+			total.durs = append(total.durs, stat.durs...)
+		}
+	}
+}
+
+func (ps *paramStats) print() {
+	if len(ps.stats) == 0 {
+		return
+	}
+
+	params := make([]string, 0, len(ps.stats))
+	for param, stat := range ps.stats {
+		sortDurations(stat.durs)
+		params = append(params, param)
+	}
+
+	failRate := func(stat *paramStat) float64 {
+		return float64(stat.failed) / float64(stat.queries)
+	}
+
+	sort.Slice(params, func(i, j int) bool {
+		a, b := ps.stats[params[i]], ps.stats[params[j]]
+		if ra, rb := failRate(a), failRate(b); ra != rb {
+			return ra > rb
+		}
+		if a.failed != b.failed {
+			return a.failed > b.failed
+		}
+		return params[i] < params[j]
+	})
+
+	if ps.stats[params[0]].failed > 0 {
+		fmt.Println("Params by failure rate:")
+		for i, param := range params {
+			stat := ps.stats[param]
+			if i == paramStatsTop || stat.failed == 0 {
+				break
+			}
+			fmt.Printf("%s: %d of %d failed (%.2f%%)\n", param, stat.failed, stat.queries, 100*failRate(stat))
+		}
+	}
+
+	sort.Slice(params, func(i, j int) bool {
+		pi, pj := percentile(ps.stats[params[i]].durs, 99), percentile(ps.stats[params[j]].durs, 99)
+		if pi != pj {
+			return pi > pj
+		}
+		return params[i] < params[j]
+	})
+
+	fmt.Println("Params by p99 latency:")
+	printed := 0
+	for _, param := range params {
+		stat := ps.stats[param]
+		if stat.queries < paramStatsMinQueries {
+			continue
+		}
+		if printed++; printed > paramStatsTop {
+			break
+		}
+		fmt.Printf("%s: p99 %s, p50 %s, %d queries\n", param, percentile(stat.durs, 99), percentile(stat.durs, 50), stat.queries)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	Phase struct {
+		Num      int
+		Action   string
+		Name     string
+		AmmoFile string
+		AnswFile string
+	}
+)
+
+var (
+	rePhaseFile = regexp.MustCompile(`^phase_(\d+)_([^.]+)\.ammo$`)
+
+	// действия, которые меняют состояние сервера
+	writePhaseActions = map[string]bool{
+		`post`: true,
+	}
+)
+
+func (p *Phase) IsWrite() bool {
+	return writePhaseActions[p.Action]
+}
+
+func (p *Phase) String() string {
+	return p.Name
+}
+
+func discoverPhases(hlcupdocsPath string) ([]*Phase, error) {
+	files, err := filepath.Glob(path.Join(hlcupdocsPath, `ammo`, `phase_*_*.ammo`))
+	if err != nil {
+		return nil, errors.Wrap(err, `filepath.Glob`)
+	}
+
+	var phases []*Phase
+	for _, file := range files {
+		match := rePhaseFile.FindStringSubmatch(path.Base(file))
+		if len(match) != 3 {
+			continue
+		}
+		num, err := strconv.Atoi(match[1])
+		if err != nil {
+			continue
+		}
+
+		p := &Phase{
+			Num:      num,
+			Action:   match[2],
+			Name:     strings.TrimSuffix(path.Base(file), `.ammo`),
+			AmmoFile: file,
+		}
+
+		answFile := path.Join(hlcupdocsPath, `answers`, p.Name+`.answ`)
+		if _, err := os.Stat(answFile); err == nil {
+			p.AnswFile = answFile
+		}
+
+		phases = append(phases, p)
+	}
+
+	sort.Slice(phases, func(i, j int) bool {
+		if phases[i].Num != phases[j].Num {
+			return phases[i].Num < phases[j].Num
+		}
+		return phases[i].Name < phases[j].Name
+	})
+
+	return phases, nil
+}
+
+// findPhase ищет фазу по номеру ("2"), действию ("post") или полному имени ("phase_2_post")
+func findPhase(phases []*Phase, sel string) (*Phase, error) {
+	var found []*Phase
+
+	num, errNum := strconv.Atoi(sel)
+	for _, p := range phases {
+		if (errNum == nil && p.Num == num) || p.Action == sel || p.Name == sel {
+			found = append(found, p)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, errors.Wrap(ErrWrongPhase, sel)
+	case 1:
+		return found[0], nil
+	default:
+		var names []string
+		for _, p := range found {
+			names = append(names, p.Name)
+		}
+		return nil, errors.Wrap(ErrAmbiguousPhase, fmt.Sprintf(`%s: %s`, sel, strings.Join(names, `, `)))
+	}
+}
+
+func listPhases() error {
+	phases, err := discoverPhases(argv.hlcupdocsPath)
+	if err != nil {
+		return err
+	}
+
+	if len(phases) == 0 {
+		fmt.Println(`no phases found in`, path.Join(argv.hlcupdocsPath, `ammo`))
+		return nil
+	}
+
+	for _, p := range phases {
+		answers := `yes`
+		if p.AnswFile == `` {
+			answers = `no`
+		}
+		mode := `read`
+		if p.IsWrite() {
+			mode = `write`
+		}
+		fmt.Printf("%d\t%s\t%s\t%s\tanswers: %s\n", p.Num, p.Action, mode, p.Name, answers)
+	}
+
+	return nil
+}
+
+// applyPhaseDefaults подстраивает режим запуска под фазу: пишущие фазы по умолчанию гоняются один раз,
+// по порядку и в один поток (-test), иначе ответы перестанут совпадать с эталонными. Явно заданные флаги не трогаются,
+// но конфликтующие с пишущей фазой перечисляются в предупреждении
+func applyPhaseDefaults() {
+	if !phase.IsWrite() {
+		return
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	if !explicit[`test`] {
+		argv.testRun = true
+		fmt.Printf("%s is a write phase: using -test\n", phase)
+	}
+
+	var conflicts []string
+	if !argv.testRun {
+		conflicts = append(conflicts, `-test=false`)
+	}
+	if explicit[`concurrent`] && argv.concurrent > 1 {
+		conflicts = append(conflicts, fmt.Sprintf(`-concurrent %d`, argv.concurrent))
+	}
+	if explicit[`tank`] && argv.tankRps != 0 {
+		conflicts = append(conflicts, fmt.Sprintf(`-tank %d`, argv.tankRps))
+	}
+	if len(conflicts) > 0 {
+		fmt.Printf("WARNING: %s is a write phase, with %s the answers will not match\n", phase, strings.Join(conflicts, ` `))
+	}
+}
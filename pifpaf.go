@@ -11,6 +11,39 @@ import (
 
 type benchResult [][]BenchResult
 
+// acquireBulletRequest готовит запрос патрона к отправке на uri. Освобождать через fasthttp.ReleaseRequest
+func acquireBulletRequest(uri []byte, request *Request) *fasthttp.Request {
+	req := fasthttp.AcquireRequest()
+	req.SetRequestURIBytes(uri)
+	for _, header := range request.Headers {
+		req.Header.SetBytesKV(header.Key, header.Value)
+	}
+	if len(request.Body) > 0 {
+		req.SetBody(request.Body)
+	}
+	if !request.IsGet {
+		req.Header.SetMethod(`POST`)
+	}
+	return req
+}
+
+// doBulletRequest отправляет один запрос патрона на сервер addr и возвращает полученный ответ
+func doBulletRequest(client *fasthttp.Client, addr string, request *Request) (Response, time.Duration, error) {
+	req := acquireBulletRequest(append([]byte(addr), request.URI...), request)
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	tnow := time.Now()
+	err := client.DoTimeout(req, resp, requestTimeout)
+	dur := time.Since(tnow)
+	if err != nil {
+		return Response{Status: -1}, dur, err
+	}
+
+	return Response{Status: resp.StatusCode(), Body: append([]byte{}, resp.Body()...)}, dur, nil
+}
+
 func pifpaf(i int, benchResultsAll *benchResult, client *fasthttp.Client, enough, queries *int64, wg *sync.WaitGroup) {
 	defer wg.Done()
 
@@ -24,18 +57,7 @@ func pifpaf(i int, benchResultsAll *benchResult, client *fasthttp.Client, enough
 	for atomic.LoadInt64(enough) == 0 {
 		for bulletIdx, bullet := range bullets {
 			uri = append(uri[:uriBase], bullet.Request.URI...)
-
-			req := fasthttp.AcquireRequest()
-			req.SetRequestURIBytes(uri)
-			for _, header := range bullet.Request.Headers {
-				req.Header.SetBytesKV(header.Key, header.Value)
-			}
-			if len(bullet.Request.Body) > 0 {
-				req.SetBody(bullet.Request.Body)
-			}
-			if !bullet.Request.IsGet {
-				req.Header.SetMethod(`POST`)
-			}
+			req := acquireBulletRequest(uri, &bullet.Request)
 
 			resp := fasthttp.AcquireResponse()
 
@@ -43,17 +65,23 @@ func pifpaf(i int, benchResultsAll *benchResult, client *fasthttp.Client, enough
 
 			myQueries++
 
+			liveMetrics.start()
 			tnow := time.Now()
-			err := client.DoTimeout(req, resp, 2*time.Second)
+			err := client.DoTimeout(req, resp, requestTimeout)
+			oneBenchResult.start = tnow
 			oneBenchResult.dur = time.Since(tnow)
 			if err != nil {
 				oneBenchResult.status = -1
+				oneBenchResult.timeout = err == fasthttp.ErrTimeout
 				//fmt.Println(`client.DoTimeout fail:`, err)
 			} else {
 				oneBenchResult.status = resp.StatusCode()
 				oneBenchResult.body = append(oneBenchResult.body, resp.Body()...)
 			}
+			liveVerdict(&oneBenchResult)
 			(*benchResultsAll)[i] = append((*benchResultsAll)[i], oneBenchResult)
+			resultLog.add(oneBenchResult)
+			liveMetrics.add(oneBenchResult)
 
 			fasthttp.ReleaseRequest(req)
 			fasthttp.ReleaseResponse(resp)
@@ -86,18 +114,7 @@ func pifpafTank(ii int, benchResultsAll *benchResult, client *fasthttp.Client, q
 
 	bullet := bullets[bulletIdx]
 	uri = append(uri[:uriBase], bullet.Request.URI...)
-
-	req := fasthttp.AcquireRequest()
-	req.SetRequestURIBytes(uri)
-	for _, header := range bullet.Request.Headers {
-		req.Header.SetBytesKV(header.Key, header.Value)
-	}
-	if len(bullet.Request.Body) > 0 {
-		req.SetBody(bullet.Request.Body)
-	}
-	if !bullet.Request.IsGet {
-		req.Header.SetMethod(`POST`)
-	}
+	req := acquireBulletRequest(uri, &bullet.Request)
 
 	resp := fasthttp.AcquireResponse()
 
@@ -105,17 +122,23 @@ func pifpafTank(ii int, benchResultsAll *benchResult, client *fasthttp.Client, q
 
 	myQueries++
 
+	liveMetrics.start()
 	tnow := time.Now()
-	err := client.DoTimeout(req, resp, 2*time.Second)
+	err := client.DoTimeout(req, resp, requestTimeout)
+	oneBenchResult.start = tnow
 	oneBenchResult.dur = time.Since(tnow)
 	if err != nil {
 		oneBenchResult.status = -1
+		oneBenchResult.timeout = err == fasthttp.ErrTimeout
 		//fmt.Println(`client.DoTimeout fail:`, err)
 	} else {
 		oneBenchResult.status = resp.StatusCode()
 		oneBenchResult.body = append(oneBenchResult.body, resp.Body()...)
 	}
+	liveVerdict(&oneBenchResult)
 	(*benchResultsAll)[ii] = append((*benchResultsAll)[ii], oneBenchResult)
+	resultLog.add(oneBenchResult)
+	liveMetrics.add(oneBenchResult)
 
 	fasthttp.ReleaseRequest(req)
 	fasthttp.ReleaseResponse(resp)
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/valyala/fasthttp"
+)
+
+// recordProxy - reverse proxy перед эталонным сервером (-addr), который пишет все проксированные
+// запросы в -out.ammo, а ответы в -out.answ. Остановка по Ctrl+C
+func recordProxy() error {
+	if argv.out == `` {
+		return errors.Wrap(ErrNoOutput, `record`)
+	}
+
+	aw, err := createAmmoWriter(argv.out, true)
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen(`tcp`, argv.listen)
+	if err != nil {
+		aw.Close()
+		return errors.Wrap(err, `net.Listen`)
+	}
+
+	var (
+		mu       sync.Mutex
+		recorded int
+		stopped  bool
+	)
+
+	client := &fasthttp.Client{}
+
+	handler := func(ctx *fasthttp.RequestCtx) {
+		var request Request
+		if !setImportedMethod(&request, string(ctx.Method())) {
+			ctx.Error(`Method not supported by recorder`, fasthttp.StatusMethodNotAllowed)
+			return
+		}
+		request.URI = append([]byte{}, ctx.RequestURI()...)
+		ctx.Request.Header.VisitAll(func(key, value []byte) {
+			if importSkipHeaders[string(bytes.ToLower(key))] {
+				return
+			}
+			request.Headers = append(request.Headers, Header{Key: append([]byte{}, key...), Value: append([]byte{}, value...)})
+		})
+		request.Body = append([]byte{}, ctx.PostBody()...)
+
+		req := fasthttp.AcquireRequest()
+		defer fasthttp.ReleaseRequest(req)
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(resp)
+
+		ctx.Request.CopyTo(req)
+		req.Header.Del(`Accept-Encoding`)
+		req.Header.Del(`Connection`)
+
+		req.SetRequestURI(argv.serverAddr + string(request.URI))
+
+		if err := client.DoTimeout(req, resp, requestTimeout); err != nil {
+			ctx.Error(err.Error(), fasthttp.StatusBadGateway)
+			return
+		}
+		resp.CopyTo(&ctx.Response)
+
+		response := Response{
+			Status: resp.StatusCode(),
+			Body:   append([]byte{}, resp.Body()...),
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if stopped {
+			return
+		}
+
+		recorded++
+		request.LineNo = recorded
+		if err := aw.write(&request, &response); err != nil {
+			fmt.Println(`cannot record request:`, err)
+		}
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		ln.Close()
+	}()
+
+	fmt.Printf("Recording %s -> %s into %s.ammo and %s.answ. Press Ctrl+C to stop\n", argv.listen, argv.serverAddr, argv.out, argv.out)
+
+	server := &fasthttp.Server{Handler: handler}
+	err = server.Serve(ln)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	stopped = true
+	if errClose := aw.Close(); errClose != nil {
+		return errors.Wrap(errClose, `close recorded files`)
+	}
+	fmt.Printf("\n%d requests recorded\n", recorded)
+
+	return errors.Wrap(err, `server.Serve`)
+}
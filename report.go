@@ -0,0 +1,384 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Отчеты о прогоне: -report-json (все, что печатается в консоль, и список ошибок),
+// -report-junit (маршрут - тест, чтобы CI показывал регрессии корректности штатно) и -report-html (reporthtml.go)
+
+const (
+	// maxReportFailures ограничивает список ошибок в отчете: при сломанном сервере их миллионы
+	maxReportFailures = 10000
+
+	// reportLatencySample - сколько задержек маршрута сохраняется в отчете для статистических сравнений
+	reportLatencySample = 1000
+)
+
+type (
+	runReport struct {
+		Config   reportConfig    `json:"config"`
+		Phase    reportPhase     `json:"phase"`
+		Routes   []reportRoute   `json:"routes"`
+		Failures []reportFailure `json:"failures"`
+		TopSlow  []reportSlow    `json:"top_slow"`
+
+		// FailuresTotal - сколько запросов провалено всего, Failures содержит первые maxReportFailures по номеру строки.
+		// FailedLines - полный список строк проваленных патронов для -baseline
+		FailuresTotal     int   `json:"failures_total"`
+		FailuresTruncated bool  `json:"failures_truncated"`
+		FailedLines       []int `json:"failed_lines"`
+
+		LatencyBucketsUs []int64         `json:"latency_buckets_us"`
+		TimeSeries       []timeSeriesRow `json:"timeseries,omitempty"`
+	}
+
+	reportConfig struct {
+		Addr       string `json:"addr"`
+		Hlcupdocs  string `json:"hlcupdocs,omitempty"`
+		Phase      string `json:"phase"`
+		AmmoFile   string `json:"ammo"`
+		AnswFile   string `json:"answ,omitempty"`
+		Oracle     string `json:"oracle,omitempty"`
+		Filter     string `json:"filter,omitempty"`
+		URI        string `json:"uri,omitempty"`
+		Test       bool   `json:"test"`
+		Concurrent uint   `json:"concurrent"`
+		Time       string `json:"time"`
+		Tank       uint   `json:"tank,omitempty"`
+	}
+
+	reportLatency struct {
+		AvgUs int64 `json:"avg_us"`
+		P50Us int64 `json:"p50_us"`
+		P90Us int64 `json:"p90_us"`
+		P95Us int64 `json:"p95_us"`
+		P99Us int64 `json:"p99_us"`
+		MaxUs int64 `json:"max_us"`
+	}
+
+	reportPhase struct {
+		Num        int              `json:"num"`
+		Name       string           `json:"name"`
+		Action     string           `json:"action"`
+		Bullets    int              `json:"bullets"`
+		Queries    int64            `json:"queries"`
+		Failed     int64            `json:"failed"`
+		DurationMs int64            `json:"duration_ms"`
+		RPS        float64          `json:"rps"`
+		Latency    reportLatency    `json:"latency"`
+		Verdicts   map[string]int64 `json:"verdicts"`
+	}
+
+	reportRoute struct {
+		Route     string           `json:"route"`
+		Queries   int64            `json:"queries"`
+		Failed    int64            `json:"failed"`
+		Latency   reportLatency    `json:"latency"`
+		Verdicts  map[string]int64 `json:"verdicts"`
+		Histogram []int64          `json:"histogram"` // по корзинам latency_buckets_us
+
+		LatencySampleUs []int64 `json:"latency_sample_us,omitempty"` // для сравнения с -baseline
+	}
+
+	reportFailure struct {
+		LineNo         int      `json:"line"`
+		Route          string   `json:"route"`
+		Method         string   `json:"method"`
+		URI            string   `json:"uri"`
+		RequestBody    string   `json:"request_body,omitempty"`
+		Verdict        string   `json:"verdict"`
+		ExpectedStatus int      `json:"expected_status"`
+		ExpectedBody   string   `json:"expected_body,omitempty"`
+		ActualStatus   int      `json:"actual_status"`
+		ActualBody     string   `json:"actual_body,omitempty"`
+		Diff           []string `json:"diff,omitempty"`
+	}
+
+	// reportFailureRef - проваленный запрос прогона, подробности (reportFailure) строятся только для попавших в отчет
+	reportFailureRef struct {
+		bulletIdx int
+		result    *BenchResult
+		verdict   string
+	}
+
+	reportSlow struct {
+		URI   string `json:"uri"`
+		DurUs int64  `json:"dur_us"`
+	}
+
+	junitTestSuites struct {
+		XMLName xml.Name         `xml:"testsuites"`
+		Suites  []junitTestSuite `xml:"testsuite"`
+	}
+
+	junitTestSuite struct {
+		Name     string          `xml:"name,attr"`
+		Tests    int             `xml:"tests,attr"`
+		Failures int             `xml:"failures,attr"`
+		Time     float64         `xml:"time,attr"`
+		Cases    []junitTestCase `xml:"testcase"`
+	}
+
+	junitTestCase struct {
+		Name      string        `xml:"name,attr"`
+		Classname string        `xml:"classname,attr"`
+		Time      float64       `xml:"time,attr"`
+		Failure   *junitFailure `xml:"failure,omitempty"`
+	}
+
+	junitFailure struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+func reportsEnabled() bool {
+	return argv.reportJSON != `` || argv.reportJUnit != `` || argv.reportHTML != `` || argv.baseline != `` || argv.assert != ``
+}
+
+// newReportFailure описывает проваленный патрон: что ждали, что получили и в чем разница
+func newReportFailure(bullet *Bullet, benchResult *BenchResult, verdict string) reportFailure {
+	method := `GET`
+	if !bullet.Request.IsGet {
+		method = `POST`
+	}
+
+	failure := reportFailure{
+		LineNo:         bullet.Request.LineNo,
+		Route:          bullet.Route,
+		Method:         method,
+		URI:            string(bullet.Request.URI),
+		RequestBody:    string(bullet.Request.Body),
+		Verdict:        verdict,
+		ExpectedStatus: bullet.Response.Status,
+		ExpectedBody:   string(bullet.Response.Body),
+		ActualStatus:   benchResult.status,
+		ActualBody:     string(benchResult.body),
+	}
+
+	switch verdict {
+	case verdictTransport:
+		failure.Diff = []string{`transport error`}
+	case verdictStatus:
+		failure.Diff = []string{fmt.Sprintf(`status: %d != %d`, benchResult.status, bullet.Response.Status)}
+	case verdictBody:
+		failure.Diff = jsDiff(benchResult.body, bullet.Response.Body)
+		if len(failure.Diff) == 0 {
+			failure.Diff = []string{`body: differs`}
+		}
+	case verdictInvariant:
+		for _, violation := range checkInvariants(&bullet.Request, benchResult.status, benchResult.body) {
+			failure.Diff = append(failure.Diff, violation.String())
+		}
+	}
+
+	return failure
+}
+
+// newReportLatency считает задержки по длительностям, сортируя их на месте
+func newReportLatency(durs []time.Duration) reportLatency {
+	if len(durs) == 0 {
+		return reportLatency{}
+	}
+	sortDurations(durs)
+
+	var sum time.Duration
+	for _, dur := range durs {
+		sum += dur
+	}
+
+	us := func(dur time.Duration) int64 { return int64(dur / time.Microsecond) }
+	return reportLatency{
+		AvgUs: us(sum / time.Duration(len(durs))),
+		P50Us: us(percentile(durs, 50)),
+		P90Us: us(percentile(durs, 90)),
+		P95Us: us(percentile(durs, 95)),
+		P99Us: us(percentile(durs, 99)),
+		MaxUs: us(durs[len(durs)-1]),
+	}
+}
+
+func buildRunReport(queries, failed int64, elapsed time.Duration, routes *routeStats, failures []reportFailureRef, top []*BenchTop) *runReport {
+	report := &runReport{
+		Config: reportConfig{
+			Addr:       argv.serverAddr,
+			Phase:      argv.phase,
+			AmmoFile:   phase.AmmoFile,
+			AnswFile:   phase.AnswFile,
+			Oracle:     argv.oracle,
+			Filter:     argv.filterReq,
+			URI:        argv.filterURI,
+			Test:       argv.testRun,
+			Concurrent: argv.concurrent,
+			Time:       argv.benchTime.String(),
+			Tank:       argv.tankRps,
+		},
+		Phase: reportPhase{
+			Num:        phase.Num,
+			Name:       phase.Name,
+			Action:     phase.Action,
+			Bullets:    len(bullets),
+			Queries:    queries,
+			Failed:     failed,
+			DurationMs: int64(elapsed / time.Millisecond),
+		},
+		FailuresTotal:    len(failures),
+		LatencyBucketsUs: latencyBucketsUs,
+	}
+	report.Phase.Verdicts = make(map[string]int64)
+	if argv.ammoFile == `` {
+		report.Config.Hlcupdocs = argv.hlcupdocsPath
+	}
+	if elapsed > 0 {
+		report.Phase.RPS = float64(queries) / elapsed.Seconds()
+	}
+
+	var all []time.Duration
+	for _, route := range routes.names() {
+		stat := routes.stats[route]
+		all = append(all, stat.durs...)
+		for verdict, count := range stat.verdicts {
+			report.Phase.Verdicts[verdict] += count
+		}
+		report.Routes = append(report.Routes, reportRoute{
+			Route:     route,
+			Queries:   stat.queries,
+			Failed:    stat.failed,
+			Latency:   newReportLatency(stat.durs),
+			Verdicts:  stat.verdicts,
+			Histogram: latencyHistogram(stat.durs),
+
+			LatencySampleUs: latencySample(stat.durs, reportLatencySample),
+		})
+	}
+	report.Phase.Latency = newReportLatency(all)
+
+	// обрезается отсортированный по строкам список, а не первые попавшиеся в порядке горутин
+	sort.SliceStable(failures, func(i, j int) bool {
+		return bullets[failures[i].bulletIdx].Request.LineNo < bullets[failures[j].bulletIdx].Request.LineNo
+	})
+	report.FailedLines = make([]int, 0)
+	for _, ref := range failures {
+		lineNo := bullets[ref.bulletIdx].Request.LineNo
+		if n := len(report.FailedLines); n == 0 || report.FailedLines[n-1] != lineNo {
+			report.FailedLines = append(report.FailedLines, lineNo)
+		}
+	}
+	if len(failures) > maxReportFailures {
+		failures = failures[:maxReportFailures]
+		report.FailuresTruncated = true
+	}
+	for _, ref := range failures {
+		report.Failures = append(report.Failures, newReportFailure(bullets[ref.bulletIdx], ref.result, ref.verdict))
+	}
+
+	for _, bt := range top {
+		if bt != nil {
+			report.TopSlow = append(report.TopSlow, reportSlow{URI: string(bt.req), DurUs: int64(bt.dur / time.Microsecond)})
+		}
+	}
+
+	return report
+}
+
+func writeReports(report *runReport) error {
+	if argv.reportJSON != `` {
+		if err := writeReportJSON(argv.reportJSON, report); err != nil {
+			return err
+		}
+		fmt.Println(`JSON report written to`, argv.reportJSON)
+	}
+	if argv.reportJUnit != `` {
+		if err := writeReportJUnit(argv.reportJUnit, report); err != nil {
+			return err
+		}
+		fmt.Println(`JUnit report written to`, argv.reportJUnit)
+	}
+	if argv.reportHTML != `` {
+		if err := writeReportHTML(argv.reportHTML, report); err != nil {
+			return err
+		}
+		fmt.Println(`HTML report written to`, argv.reportHTML)
+	}
+	return nil
+}
+
+func writeReportJSON(fileName string, report *runReport) error {
+	fd, err := os.Create(fileName)
+	if err != nil {
+		return errors.Wrap(err, `os.Create`)
+	}
+
+	enc := json.NewEncoder(fd)
+	enc.SetIndent(``, `  `)
+	if err := enc.Encode(report); err != nil {
+		fd.Close()
+		return errors.Wrap(err, `json.Encode`)
+	}
+	return errors.Wrap(fd.Close(), `fd.Close`)
+}
+
+// writeReportJUnit пишет маршруты как тесты: тест провален, если провален хоть один патрон маршрута
+func writeReportJUnit(fileName string, report *runReport) error {
+	failuresByRoute := make(map[string][]reportFailure)
+	for _, failure := range report.Failures {
+		failuresByRoute[failure.Route] = append(failuresByRoute[failure.Route], failure)
+	}
+
+	suite := junitTestSuite{
+		Name: `highloadcup_tester.` + report.Phase.Name,
+		Time: float64(report.Phase.DurationMs) / 1000,
+	}
+
+	for _, route := range report.Routes {
+		testCase := junitTestCase{
+			Name:      route.Route,
+			Classname: suite.Name,
+			Time:      float64(route.Latency.AvgUs*route.Queries) / 1e6,
+		}
+
+		if route.Failed > 0 {
+			var text strings.Builder
+			for _, failure := range failuresByRoute[route.Route] {
+				fmt.Fprintf(&text, "line#%d %s %s: %s\n", failure.LineNo, failure.Method, failure.URI, strings.Join(failure.Diff, `; `))
+			}
+			testCase.Failure = &junitFailure{
+				Message: fmt.Sprintf(`%d of %d requests failed`, route.Failed, route.Queries),
+				Text:    text.String(),
+			}
+			suite.Failures++
+		}
+
+		suite.Cases = append(suite.Cases, testCase)
+		suite.Tests++
+	}
+
+	data, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, ``, `  `)
+	if err != nil {
+		return errors.Wrap(err, `xml.Marshal`)
+	}
+
+	fd, err := os.Create(fileName)
+	if err != nil {
+		return errors.Wrap(err, `os.Create`)
+	}
+
+	if _, err := fd.WriteString(xml.Header); err != nil {
+		fd.Close()
+		return errors.Wrap(err, `write junit`)
+	}
+	if _, err := fd.Write(append(data, '\n')); err != nil {
+		fd.Close()
+		return errors.Wrap(err, `write junit`)
+	}
+	return errors.Wrap(fd.Close(), `fd.Close`)
+}
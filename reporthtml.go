@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HTML отчет -report-html: один файл без внешних ресурсов (стили внутри, графики - готовый SVG),
+// чтобы его можно было приложить к CI или отправить в чат и открыть без сети
+
+const (
+	htmlChartWidth  = 900
+	htmlChartHeight = 220
+	htmlChartPad    = 40
+)
+
+type (
+	htmlSeries struct {
+		name, color string
+		values      []float64
+	}
+
+	htmlVerdictRow struct {
+		Verdict string
+		Count   int64
+		Routes  string
+	}
+
+	htmlRouteRow struct {
+		reportRoute
+		Chart template.HTML
+	}
+
+	htmlReport struct {
+		*runReport
+		Generated  string
+		RPSChart   template.HTML
+		LatChart   template.HTML
+		Verdicts   []htmlVerdictRow
+		RouteRows  []htmlRouteRow
+		NoFailures bool
+	}
+)
+
+var htmlReportTemplate = template.Must(template.New(`report`).Funcs(template.FuncMap{
+	`ms`: func(us int64) string { return fmt.Sprintf(`%.2f`, float64(us)/1000) },
+	`percent`: func(part, total int64) string {
+		if total == 0 {
+			return `0.00`
+		}
+		return fmt.Sprintf(`%.2f`, 100*float64(part)/float64(total))
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>highloadcup_tester: {{.Phase.Name}}</title>
+<style>
+body { font: 14px/1.4 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 24px; color: #222; }
+h1 { font-size: 22px; } h2 { font-size: 18px; margin-top: 32px; border-bottom: 1px solid #ddd; }
+table { border-collapse: collapse; margin: 8px 0; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: right; vertical-align: top; }
+th { background: #f4f4f4; } td.l, th.l { text-align: left; }
+.fail { color: #c00; font-weight: bold; } .ok { color: #080; font-weight: bold; }
+details { border: 1px solid #ddd; margin: 4px 0; padding: 4px 8px; }
+summary { cursor: pointer; font-family: monospace; }
+pre { background: #f8f8f8; padding: 6px; overflow-x: auto; white-space: pre-wrap; word-break: break-all; margin: 4px 0; }
+svg text { font: 11px sans-serif; fill: #555; }
+</style>
+</head>
+<body>
+<h1>Phase {{.Phase.Num}} {{.Phase.Name}} ({{.Phase.Action}}) against {{.Config.Addr}}</h1>
+<p>Generated {{.Generated}}; ammo {{.Config.AmmoFile}}{{if .Config.AnswFile}}, answers {{.Config.AnswFile}}{{end}}{{if .Config.Oracle}}, oracle {{.Config.Oracle}}{{end}}</p>
+<table>
+<tr><th class="l">Bullets</th><td>{{.Phase.Bullets}}</td></tr>
+<tr><th class="l">Queries</th><td>{{.Phase.Queries}}</td></tr>
+<tr><th class="l">Failed</th><td class="{{if .Phase.Failed}}fail{{else}}ok{{end}}">{{.Phase.Failed}} ({{percent .Phase.Failed .Phase.Queries}}%)</td></tr>
+<tr><th class="l">Duration</th><td>{{.Phase.DurationMs}} ms</td></tr>
+<tr><th class="l">RPS</th><td>{{printf "%.1f" .Phase.RPS}}</td></tr>
+<tr><th class="l">Latency avg / p50 / p90 / p99 / max, ms</th><td>{{ms .Phase.Latency.AvgUs}} / {{ms .Phase.Latency.P50Us}} / {{ms .Phase.Latency.P90Us}} / {{ms .Phase.Latency.P99Us}} / {{ms .Phase.Latency.MaxUs}}</td></tr>
+</table>
+
+<h2>RPS over time</h2>
+{{.RPSChart}}
+<h2>Latency over time, ms</h2>
+{{.LatChart}}
+
+<h2>Failures by verdict</h2>
+{{if .NoFailures}}<p class="ok">No failures</p>{{else}}
+<table>
+<tr><th class="l">Verdict</th><th>Count</th><th class="l">Routes</th></tr>
+{{range .Verdicts}}<tr><td class="l">{{.Verdict}}</td><td>{{.Count}}</td><td class="l">{{.Routes}}</td></tr>
+{{end}}</table>{{end}}
+
+<h2>Routes</h2>
+<table>
+<tr><th class="l">Route</th><th>Queries</th><th>Failed</th><th>avg</th><th>p50</th><th>p90</th><th>p99</th><th>max, ms</th><th class="l">Latency histogram</th></tr>
+{{range .RouteRows}}<tr><td class="l">{{.Route}}</td><td>{{.Queries}}</td><td{{if .Failed}} class="fail"{{end}}>{{.Failed}}</td><td>{{ms .Latency.AvgUs}}</td><td>{{ms .Latency.P50Us}}</td><td>{{ms .Latency.P90Us}}</td><td>{{ms .Latency.P99Us}}</td><td>{{ms .Latency.MaxUs}}</td><td class="l">{{.Chart}}</td></tr>
+{{end}}</table>
+
+{{if .Failures}}<h2>Failed bullets ({{len .Failures}})</h2>
+{{if .FailuresTruncated}}<p>First {{len .Failures}} by line of {{.FailuresTotal}} failed requests</p>{{end}}
+{{range .Failures}}<details>
+<summary>line#{{.LineNo}} {{.Verdict}} {{.Method}} {{.URI}}</summary>
+{{if .RequestBody}}<p>Request body:</p><pre>{{.RequestBody}}</pre>{{end}}
+<p>Status: got {{.ActualStatus}}, expected {{.ExpectedStatus}}</p>
+{{if .Diff}}<p>Diff:</p><pre>{{range .Diff}}{{.}}
+{{end}}</pre>{{end}}
+{{if .ExpectedBody}}<p>Expected body:</p><pre>{{.ExpectedBody}}</pre>{{end}}
+{{if .ActualBody}}<p>Actual body:</p><pre>{{.ActualBody}}</pre>{{end}}
+</details>
+{{end}}{{end}}
+
+{{if .TopSlow}}<h2>Top slow requests</h2>
+<table>
+<tr><th class="l">URI</th><th>ms</th></tr>
+{{range .TopSlow}}<tr><td class="l">{{.URI}}</td><td>{{ms .DurUs}}</td></tr>
+{{end}}</table>{{end}}
+</body>
+</html>
+`))
+
+func writeReportHTML(fileName string, report *runReport) error {
+	page := htmlReport{
+		runReport:  report,
+		Generated:  time.Now().Format(time.RFC3339),
+		NoFailures: report.Phase.Failed == 0,
+	}
+
+	var (
+		secs           []float64
+		rps, p50, p99  []float64
+		failedBySecond []float64
+	)
+	for _, row := range report.TimeSeries {
+		if row.Route != timeSeriesAll {
+			continue
+		}
+		var failed int64
+		for verdict, count := range row.Verdicts {
+			if verdict != verdictOK {
+				failed += count
+			}
+		}
+		secs = append(secs, float64(row.Sec))
+		rps = append(rps, float64(row.RPS))
+		failedBySecond = append(failedBySecond, float64(failed))
+		p50 = append(p50, float64(row.P50Us)/1000)
+		p99 = append(p99, float64(row.P99Us)/1000)
+	}
+	page.RPSChart = svgLineChart(secs, []htmlSeries{{`rps`, `#1f77b4`, rps}, {`failed`, `#d62728`, failedBySecond}})
+	page.LatChart = svgLineChart(secs, []htmlSeries{{`p50`, `#2ca02c`, p50}, {`p99`, `#ff7f0e`, p99}})
+
+	routesByVerdict := make(map[string][]string)
+	for _, route := range report.Routes {
+		for verdict, count := range route.Verdicts {
+			if verdict != verdictOK && count > 0 {
+				routesByVerdict[verdict] = append(routesByVerdict[verdict], fmt.Sprintf(`%s (%d)`, route.Route, count))
+			}
+		}
+		page.RouteRows = append(page.RouteRows, htmlRouteRow{reportRoute: route, Chart: svgHistogram(report.LatencyBucketsUs, route.Histogram)})
+	}
+	for verdict, count := range report.Phase.Verdicts {
+		if verdict != verdictOK && count > 0 {
+			page.Verdicts = append(page.Verdicts, htmlVerdictRow{Verdict: verdict, Count: count, Routes: strings.Join(routesByVerdict[verdict], `, `)})
+		}
+	}
+	sort.Slice(page.Verdicts, func(i, j int) bool {
+		if page.Verdicts[i].Count != page.Verdicts[j].Count {
+			return page.Verdicts[i].Count > page.Verdicts[j].Count
+		}
+		return page.Verdicts[i].Verdict < page.Verdicts[j].Verdict
+	})
+
+	fd, err := os.Create(fileName)
+	if err != nil {
+		return errors.Wrap(err, `os.Create`)
+	}
+
+	if err := htmlReportTemplate.Execute(fd, page); err != nil {
+		fd.Close()
+		return errors.Wrap(err, `html report`)
+	}
+	return errors.Wrap(fd.Close(), `fd.Close`)
+}
+
+// svgLineChart рисует ряды по секундам в общих осях
+func svgLineChart(xs []float64, series []htmlSeries) template.HTML {
+	if len(xs) == 0 {
+		return template.HTML(`<p>No time series</p>`)
+	}
+
+	maxX, maxY := xs[len(xs)-1], 0.0
+	for _, s := range series {
+		for _, v := range s.values {
+			if v > maxY {
+				maxY = v
+			}
+		}
+	}
+	if maxX == 0 {
+		maxX = 1
+	}
+	if maxY == 0 {
+		maxY = 1
+	}
+
+	w, h, pad := float64(htmlChartWidth), float64(htmlChartHeight), float64(htmlChartPad)
+	px := func(x float64) float64 { return pad + x/maxX*(w-2*pad) }
+	py := func(y float64) float64 { return h - pad - y/maxY*(h-2*pad) }
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d">`, htmlChartWidth, htmlChartHeight)
+	fmt.Fprintf(&svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#999"/>`, pad, h-pad, w-pad, h-pad)
+	fmt.Fprintf(&svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#999"/>`, pad, pad, pad, h-pad)
+	fmt.Fprintf(&svg, `<text x="2" y="%.1f">%.4g</text><text x="2" y="%.1f">0</text>`, pad+4, maxY, h-pad)
+	fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f">0s</text><text x="%.1f" y="%.1f">%.0fs</text>`, pad, h-pad+14, w-pad-20, h-pad+14, maxX)
+
+	for i, s := range series {
+		points := make([]string, 0, len(xs))
+		for k, x := range xs {
+			points = append(points, fmt.Sprintf(`%.1f,%.1f`, px(x), py(s.values[k])))
+		}
+		fmt.Fprintf(&svg, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="%s"/>`, s.color, strings.Join(points, ` `))
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%d" style="fill:%s">%s</text>`, pad+float64(i)*80, 14, s.color, html.EscapeString(s.name))
+	}
+	svg.WriteString(`</svg>`)
+
+	return template.HTML(svg.String())
+}
+
+// svgHistogram рисует гистограмму задержек маршрута по корзинам latencyBucketsUs
+func svgHistogram(bucketsUs []int64, counts []int64) template.HTML {
+	const barWidth, height = 22, 60
+
+	var maxCount int64
+	for _, count := range counts {
+		if count > maxCount {
+			maxCount = count
+		}
+	}
+	if maxCount == 0 {
+		return ``
+	}
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d">`, barWidth*len(counts), height+14)
+	for i, count := range counts {
+		label := `>` + formatBucketUs(bucketsUs[len(bucketsUs)-1])
+		if i < len(bucketsUs) {
+			label = `≤` + formatBucketUs(bucketsUs[i])
+		}
+		barHeight := float64(height) * float64(count) / float64(maxCount)
+		fmt.Fprintf(&svg, `<rect x="%d" y="%.1f" width="%d" height="%.1f" fill="#1f77b4"><title>%s: %d</title></rect>`,
+			i*barWidth+1, float64(height)-barHeight, barWidth-2, barHeight, html.EscapeString(label), count)
+		if i%3 == 0 && i < len(bucketsUs) {
+			fmt.Fprintf(&svg, `<text x="%d" y="%d">%s</text>`, i*barWidth, height+12, html.EscapeString(formatBucketUs(bucketsUs[i])))
+		}
+	}
+	svg.WriteString(`</svg>`)
+
+	return template.HTML(svg.String())
+}
+
+func formatBucketUs(us int64) string {
+	switch {
+	case us >= 1000000:
+		return fmt.Sprintf(`%ds`, us/1000000)
+	case us >= 1000:
+		return fmt.Sprintf(`%gms`, float64(us)/1000)
+	}
+	return fmt.Sprintf(`%dus`, us)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Воспроизведение проваленных патронов (-repro dir/): команды curl (failed.sh), файл .http для JetBrains/VSCode REST Client
+// (failed.http) и таблица для go test (failed_test.go) с запросом, ожидаемым статусом и телом ответа
+
+const reproTestHeader = `package repro
+
+// Проваленные патроны %s, сгенерировано highloadcup_tester -repro.
+// Сервер берется из HLC_ADDR, по умолчанию %s
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var failedBullets = []struct {
+	name           string
+	method         string
+	uri            string
+	headers        map[string]string
+	body           string
+	expectedStatus int
+	expectedBody   string
+	rawBody        bool // ожидаемое тело не JSON объект, сравнивается побайтно
+}{
+`
+
+const reproTestFooter = `}
+
+func TestFailedBullets(t *testing.T) {
+	addr := os.Getenv("HLC_ADDR")
+	if addr == "" {
+		addr = %q
+	}
+
+	for _, tc := range failedBullets {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, addr+tc.uri, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range tc.headers {
+				req.Header.Set(key, value)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tc.expectedStatus {
+				t.Fatalf("status %%d, expected %%d", resp.StatusCode, tc.expectedStatus)
+			}
+			if tc.expectedBody == "" {
+				return
+			}
+			if tc.rawBody {
+				if !bytes.Equal(bytes.TrimSpace(body), bytes.TrimSpace([]byte(tc.expectedBody))) {
+					t.Fatalf("body\n%%s\nexpected\n%%s", body, tc.expectedBody)
+				}
+				return
+			}
+
+			var got, expected interface{}
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("invalid JSON %%s: %%s", body, err)
+			}
+			if err := json.Unmarshal([]byte(tc.expectedBody), &expected); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Fatalf("body\n%%s\nexpected\n%%s", body, tc.expectedBody)
+			}
+		})
+	}
+}
+`
+
+// writeRepro пишет воспроизведения патронов с индексами из failed (индекс -> вердикт) в dir
+func writeRepro(dir string, failed map[int]string) error {
+	if len(failed) == 0 {
+		fmt.Println(`No failed bullets to reproduce`)
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, `os.MkdirAll`)
+	}
+
+	idxs := failedBulletIdxs(failed)
+
+	writers := []struct {
+		fileName string
+		write    func(w *bytes.Buffer, idxs []int, failed map[int]string)
+	}{
+		{`failed.sh`, writeReproCurl},
+		{`failed.http`, writeReproHTTP},
+		{`failed_test.go`, writeReproGoTest},
+	}
+
+	for _, writer := range writers {
+		var buf bytes.Buffer
+		writer.write(&buf, idxs, failed)
+
+		data, perm := buf.Bytes(), os.FileMode(0644)
+		if strings.HasSuffix(writer.fileName, `.sh`) {
+			perm = 0755
+		}
+		if strings.HasSuffix(writer.fileName, `.go`) {
+			formatted, err := format.Source(data)
+			if err != nil {
+				return errors.Wrap(err, `format.Source`)
+			}
+			data = formatted
+		}
+
+		if err := ioutil.WriteFile(path.Join(dir, writer.fileName), data, perm); err != nil {
+			return errors.Wrap(err, `ioutil.WriteFile`)
+		}
+	}
+
+	fmt.Printf("Reproductions of %d failed bullets written to %s (failed.sh, failed.http, failed_test.go)\n", len(idxs), dir)
+
+	return nil
+}
+
+// reproHeaders - заголовки патрона без Content-Length: его посчитают curl и HTTP клиенты
+func reproHeaders(request *Request) []Header {
+	var headers []Header
+	for _, header := range request.Headers {
+		if !bytes.EqualFold(header.Key, headerContentLength) {
+			headers = append(headers, header)
+		}
+	}
+	return headers
+}
+
+func reproMethod(request *Request) string {
+	if request.IsGet {
+		return `GET`
+	}
+	return `POST`
+}
+
+func reproTitle(bullet *Bullet, verdict string) string {
+	return fmt.Sprintf(`line#%d %s: %s, expected status %d`, bullet.Request.LineNo, bullet.Route, verdict, bullet.Response.Status)
+}
+
+func shellQuote(s string) string {
+	return `'` + strings.Replace(s, `'`, `'\''`, -1) + `'`
+}
+
+func writeReproCurl(w *bytes.Buffer, idxs []int, failed map[int]string) {
+	fmt.Fprintf(w, "#!/bin/sh\n# Failed bullets of %s\nHLC_ADDR=${HLC_ADDR:-%s}\n", phase, argv.serverAddr)
+
+	for _, bulletIdx := range idxs {
+		bullet := bullets[bulletIdx]
+		request := &bullet.Request
+
+		fmt.Fprintf(w, "\n# %s\n", reproTitle(bullet, failed[bulletIdx]))
+		fmt.Fprintf(w, "curl -sS -i -X %s \"$HLC_ADDR\"%s", reproMethod(request), shellQuote(string(request.URI)))
+		for _, header := range reproHeaders(request) {
+			fmt.Fprintf(w, " \\\n  -H %s", shellQuote(string(header.Key)+`: `+string(header.Value)))
+		}
+		if len(request.Body) > 0 || !request.IsGet {
+			fmt.Fprintf(w, " \\\n  --data-binary %s", shellQuote(string(request.Body)))
+		}
+		w.WriteString("\n")
+		if len(bullet.Response.Body) > 0 {
+			fmt.Fprintf(w, "# expected body: %s\n", singleLine(bullet.Response.Body))
+		}
+	}
+}
+
+func writeReproHTTP(w *bytes.Buffer, idxs []int, failed map[int]string) {
+	fmt.Fprintf(w, "# Failed bullets of %s\n@addr = %s\n", phase, argv.serverAddr)
+
+	for _, bulletIdx := range idxs {
+		bullet := bullets[bulletIdx]
+		request := &bullet.Request
+
+		fmt.Fprintf(w, "\n### %s\n", reproTitle(bullet, failed[bulletIdx]))
+		if len(bullet.Response.Body) > 0 {
+			fmt.Fprintf(w, "# expected body: %s\n", singleLine(bullet.Response.Body))
+		}
+		fmt.Fprintf(w, "%s {{addr}}%s\n", reproMethod(request), request.URI)
+		for _, header := range reproHeaders(request) {
+			fmt.Fprintf(w, "%s: %s\n", header.Key, header.Value)
+		}
+		if len(request.Body) > 0 {
+			fmt.Fprintf(w, "\n%s\n", request.Body)
+		}
+	}
+}
+
+func writeReproGoTest(w *bytes.Buffer, idxs []int, failed map[int]string) {
+	fmt.Fprintf(w, reproTestHeader, phase, argv.serverAddr)
+
+	for _, bulletIdx := range idxs {
+		bullet := bullets[bulletIdx]
+		request := &bullet.Request
+
+		fmt.Fprintf(w, "\t{\n\t\tname: %q,\n\t\tmethod: %q,\n\t\turi: %q,\n", reproTitle(bullet, failed[bulletIdx]), reproMethod(request), request.URI)
+		if headers := reproHeaders(request); len(headers) > 0 {
+			w.WriteString("\t\theaders: map[string]string{\n")
+			for _, header := range headers {
+				fmt.Fprintf(w, "\t\t\t%q: %q,\n", header.Key, header.Value)
+			}
+			w.WriteString("\t\t},\n")
+		}
+		if len(request.Body) > 0 {
+			fmt.Fprintf(w, "\t\tbody: %q,\n", request.Body)
+		}
+		fmt.Fprintf(w, "\t\texpectedStatus: %d,\n", bullet.Response.Status)
+		if len(bullet.Response.Body) > 0 {
+			fmt.Fprintf(w, "\t\texpectedBody: %q,\n", bullet.Response.Body)
+		}
+		if bullet.Response.RawBody {
+			w.WriteString("\t\trawBody: true,\n")
+		}
+		w.WriteString("\t},\n")
+	}
+
+	fmt.Fprintf(w, reproTestFooter, argv.serverAddr)
+}
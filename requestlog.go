@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Потоковый лог результатов запросов: -log-phout в формате phout.txt Яндекс.Танка и -log-ndjson.
+// Воркеры проверяют ответ и отправляют результат с вердиктом в канал, запись идет в отдельной горутине
+
+const (
+	requestLogQueue = 64 * 1024
+
+	// коды net_code в phout: 0 - успех, 110 - таймаут (ETIMEDOUT), 1 - прочие ошибки соединения
+	phoutNetOK      = 0
+	phoutNetError   = 1
+	phoutNetTimeout = 110
+)
+
+type (
+	requestLog struct {
+		results chan BenchResult
+		done    chan error
+
+		phout, ndjson   *os.File
+		phoutW, ndjsonW *bufio.Writer
+		ndjsonEnc       *json.Encoder
+	}
+
+	requestLogEntry struct {
+		Ts        float64 `json:"ts"`
+		Line      int     `json:"line"`
+		Route     string  `json:"route"`
+		URI       string  `json:"uri"`
+		Status    int     `json:"status"`
+		LatencyUs int64   `json:"latency_us"`
+		Bytes     int     `json:"bytes"`
+		Verdict   string  `json:"verdict"`
+	}
+)
+
+var (
+	// resultLog - открытый лог текущего прогона, nil если не нужен
+	resultLog *requestLog
+)
+
+func openRequestLog() (*requestLog, error) {
+	if argv.logPhout == `` && argv.logNDJSON == `` {
+		return nil, nil
+	}
+
+	rl := &requestLog{
+		results: make(chan BenchResult, requestLogQueue),
+		done:    make(chan error, 1),
+	}
+
+	var err error
+	if argv.logPhout != `` {
+		if rl.phout, err = os.Create(argv.logPhout); err != nil {
+			return nil, errors.Wrap(err, `os.Create`)
+		}
+		rl.phoutW = bufio.NewWriterSize(rl.phout, 1<<20)
+	}
+	if argv.logNDJSON != `` {
+		if rl.ndjson, err = os.Create(argv.logNDJSON); err != nil {
+			if rl.phout != nil {
+				rl.phout.Close()
+			}
+			return nil, errors.Wrap(err, `os.Create`)
+		}
+		rl.ndjsonW = bufio.NewWriterSize(rl.ndjson, 1<<20)
+		rl.ndjsonEnc = json.NewEncoder(rl.ndjsonW)
+		rl.ndjsonEnc.SetEscapeHTML(false)
+	}
+
+	go rl.loop()
+
+	return rl, nil
+}
+
+// add отправляет результат в лог. Безопасно для nil
+func (rl *requestLog) add(result BenchResult) {
+	if rl != nil {
+		rl.results <- result
+	}
+}
+
+// Close дожидается записи всех результатов и закрывает файлы
+func (rl *requestLog) Close() error {
+	if rl == nil {
+		return nil
+	}
+	close(rl.results)
+	return <-rl.done
+}
+
+func (rl *requestLog) loop() {
+	var err error
+	for result := range rl.results {
+		if err == nil {
+			err = rl.write(&result)
+		}
+	}
+
+	for _, w := range []*bufio.Writer{rl.phoutW, rl.ndjsonW} {
+		if w != nil {
+			if errFlush := w.Flush(); err == nil && errFlush != nil {
+				err = errors.Wrap(errFlush, `bufio.Flush`)
+			}
+		}
+	}
+	for _, fd := range []*os.File{rl.phout, rl.ndjson} {
+		if fd != nil {
+			fd.Close()
+		}
+	}
+
+	rl.done <- err
+}
+
+func (rl *requestLog) write(result *BenchResult) error {
+	bullet := bullets[result.bulletIdx]
+
+	ts := float64(result.start.UnixNano()) / float64(time.Second)
+	latencyUs := int64(result.dur / time.Microsecond)
+
+	if rl.phoutW != nil {
+		netCode, protoCode := phoutNetOK, result.status
+		if result.timeout {
+			netCode, protoCode = phoutNetTimeout, 0
+		} else if result.status < 0 {
+			netCode, protoCode = phoutNetError, 0
+		}
+		sizeOut := len(bullet.Request.URI) + len(bullet.Request.Body)
+
+		// time tag interval_real connect_time send_time latency receive_time interval_event size_out size_in net_code proto_code
+		_, err := fmt.Fprintf(rl.phoutW, "%.3f\t%s\t%d\t0\t0\t%d\t0\t%d\t%d\t%d\t%d\t%d\n",
+			ts, bullet.Route, latencyUs, latencyUs, latencyUs, sizeOut, len(result.body), netCode, protoCode)
+		if err != nil {
+			return errors.Wrap(err, `write phout`)
+		}
+	}
+
+	if rl.ndjsonEnc != nil {
+		err := rl.ndjsonEnc.Encode(requestLogEntry{
+			Ts:        ts,
+			Line:      bullet.Request.LineNo,
+			Route:     bullet.Route,
+			URI:       string(bullet.Request.URI),
+			Status:    result.status,
+			LatencyUs: latencyUs,
+			Bytes:     len(result.body),
+			Verdict:   result.verdict,
+		})
+		if err != nil {
+			return errors.Wrap(err, `write ndjson`)
+		}
+	}
+
+	return nil
+}
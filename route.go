@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	routeStat struct {
+		queries, failed int64
+		dur             time.Duration
+		durs            []time.Duration  // только для отчетов
+		verdicts        map[string]int64 // только для отчетов
+	}
+
+	routeStats struct {
+		mu    sync.Mutex
+		stats map[string]*routeStat
+	}
+)
+
+// requestRoute возвращает имя маршрута: тег патрона, если он есть, иначе "METHOD:/path/" из URI.
+// Числовые куски пути заменяются на <id>, чтобы /accounts/123/ и /accounts/456/ считались вместе
+func requestRoute(request *Request) string {
+	if len(request.Tag) > 0 {
+		return normalizeRoute(string(request.Tag))
+	}
+
+	uri := request.URI
+	if pos := bytes.IndexByte(uri, '?'); pos >= 0 {
+		uri = uri[:pos]
+	}
+
+	method := `POST`
+	if request.IsGet {
+		method = `GET`
+	}
+
+	return normalizeRoute(method + `:` + string(uri))
+}
+
+func normalizeRoute(route string) string {
+	if !strings.Contains(route, `/`) {
+		return route
+	}
+
+	parts := strings.Split(route, `/`)
+	for i, part := range parts {
+		if i > 0 && len(part) > 0 && strings.Trim(part, `0123456789`) == `` {
+			parts[i] = `<id>`
+		}
+	}
+	return strings.Join(parts, `/`)
+}
+
+func newRouteStats() *routeStats {
+	return &routeStats{stats: make(map[string]*routeStat)}
+}
+
+func (rs *routeStats) merge(my map[string]*routeStat) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	for route, stat := range my {
+		if total, ok := rs.stats[route]; !ok {
+			rs.stats[route] = stat
+		} else {
+			total.queries += stat.queries
+			total.failed += stat.failed
+			total.dur += stat.dur
+			total.durs = append(total.durs, stat.durs...)
+			for verdict, count := range stat.verdicts {
+				if total.verdicts == nil {
+					total.verdicts = make(map[string]int64)
+				}
+				total.verdicts[verdict] += count
+			}
+		}
+	}
+}
+
+// names возвращает маршруты по алфавиту
+func (rs *routeStats) names() []string {
+	routes := make([]string, 0, len(rs.stats))
+	for route := range rs.stats {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+func (rs *routeStats) print() {
+	fmt.Println("Routes:")
+	for _, route := range rs.names() {
+		stat := rs.stats[route]
+		fmt.Printf("%s: %d queries, %d failed, avg %s\n", route, stat.queries, stat.failed, stat.dur/time.Duration(stat.queries))
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/valyala/fasthttp"
+)
+
+// serveAnswers поднимает на -listen сервер, который отвечает записанными ответами фазы.
+// Ответ ищется по методу и URI; если один и тот же запрос встречается несколько раз,
+// ответы выдаются по очереди в порядке патронов, по кругу
+func serveAnswers() error {
+	if err := loadData(); err != nil {
+		return errors.Wrap(err, `Cannot load data from `+argv.hlcupdocsPath)
+	}
+
+	type answers struct {
+		responses []*Response
+		next      int
+	}
+
+	var mu sync.Mutex
+	byRequest := make(map[string]*answers)
+
+	for _, bullet := range bullets {
+		key := serveKey(bullet.Request.IsGet, bullet.Request.URI)
+		a, ok := byRequest[key]
+		if !ok {
+			a = &answers{}
+			byRequest[key] = a
+		}
+		a.responses = append(a.responses, &bullet.Response)
+	}
+
+	handler := func(ctx *fasthttp.RequestCtx) {
+		mu.Lock()
+		var response *Response
+		if a, ok := byRequest[serveKey(ctx.IsGet(), ctx.RequestURI())]; ok {
+			response = a.responses[a.next%len(a.responses)]
+			a.next++
+		}
+		mu.Unlock()
+
+		if response == nil || response.Status == 0 {
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+			return
+		}
+
+		ctx.SetStatusCode(response.Status)
+		if len(response.Body) > 0 {
+			ctx.SetContentType(`application/json`)
+			ctx.SetBody(response.Body)
+		}
+	}
+
+	ln, err := net.Listen(`tcp`, argv.listen)
+	if err != nil {
+		return errors.Wrap(err, `net.Listen`)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		ln.Close()
+	}()
+
+	fmt.Printf("Serving %d answers of %s (%d unique requests) on %s. Press Ctrl+C to stop\n", len(bullets), phase, len(byRequest), argv.listen)
+
+	server := &fasthttp.Server{Handler: handler}
+	return errors.Wrap(server.Serve(ln), `server.Serve`)
+}
+
+func serveKey(isGet bool, uri []byte) string {
+	if isGet {
+		return `GET ` + string(uri)
+	}
+	return `POST ` + string(uri)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SLO проверки после прогона (-assert): доля ошибок, отсутствие ошибок соединения, минимальный rps
+// и задержки по маршрутам. Провал корректности и провал производительности дают разные коды выхода
+
+const (
+	// коды выхода: 1 - ошибка самого тестера (log.Fatal)
+	exitCodeCorrectness = 2
+	exitCodePerformance = 3
+
+	sloErrorRate   = `max-error-rate`
+	sloMinRPS      = `min-rps`
+	sloNoTransport = `no-transport-errors`
+	sloLatency     = `latency`
+)
+
+var (
+	ErrWrongAssertion = errors.New(`Wrong -assert`)
+
+	// reSloLatency: p99<5ms или p99[/accounts/filter/]<5ms (маршруты, содержащие подстроку)
+	reSloLatency = regexp.MustCompile(`^(avg|p50|p90|p95|p99|max)(?:\[([^\]]+)\])?<(.+)$`)
+)
+
+type (
+	sloAssertion struct {
+		text   string
+		kind   string
+		metric string // для задержек
+		route  string // подстрока маршрута для задержек, пустая - все маршруты
+		limit  float64
+		maxDur time.Duration
+	}
+)
+
+// parseAssertions разбирает список проверок через запятую, например "max-error-rate=0,p99<5ms,min-rps=20000,no-transport-errors"
+func parseAssertions(value string) ([]sloAssertion, error) {
+	var asserts []sloAssertion
+	for _, text := range strings.Split(value, `,`) {
+		text = strings.TrimSpace(text)
+		if text == `` {
+			continue
+		}
+
+		a := sloAssertion{text: text}
+		if match := reSloLatency.FindStringSubmatch(text); len(match) > 0 {
+			maxDur, err := time.ParseDuration(match[3])
+			if err != nil {
+				return nil, errors.Wrap(ErrWrongAssertion, text)
+			}
+			a.kind, a.metric, a.route, a.maxDur = sloLatency, match[1], match[2], maxDur
+			asserts = append(asserts, a)
+			continue
+		}
+
+		parts := strings.SplitN(text, `=`, 2)
+		switch a.kind = parts[0]; a.kind {
+		case sloNoTransport:
+			if len(parts) != 1 {
+				return nil, errors.Wrap(ErrWrongAssertion, text)
+			}
+		case sloErrorRate, sloMinRPS:
+			if len(parts) != 2 {
+				return nil, errors.Wrap(ErrWrongAssertion, text)
+			}
+			limit, err := strconv.ParseFloat(strings.TrimSuffix(parts[1], `%`), 64)
+			if err != nil || limit < 0 {
+				return nil, errors.Wrap(ErrWrongAssertion, text)
+			}
+			a.limit = limit
+		default:
+			return nil, errors.Wrap(ErrWrongAssertion, text)
+		}
+		asserts = append(asserts, a)
+	}
+
+	if len(asserts) == 0 {
+		return nil, errors.Wrap(ErrWrongAssertion, `empty`)
+	}
+	return asserts, nil
+}
+
+// checkAssertions печатает таблицу проверок и сообщает, какие классы проверок провалены
+func checkAssertions(asserts []sloAssertion, report *runReport) (correctnessFailed, performanceFailed bool) {
+	fmt.Println("Assertions:")
+
+	row := func(ok bool, text, route, actual string) {
+		result := `PASS`
+		if !ok {
+			result = `FAIL`
+		}
+		if route != `` {
+			text += ` ` + route
+		}
+		fmt.Printf("%s  %-50s %s\n", result, text, actual)
+	}
+
+	for _, a := range asserts {
+		switch a.kind {
+		case sloErrorRate:
+			var rate float64
+			if report.Phase.Queries > 0 {
+				rate = 100 * float64(report.Phase.Failed) / float64(report.Phase.Queries)
+			}
+			ok := rate <= a.limit
+			correctnessFailed = correctnessFailed || !ok
+			row(ok, a.text, ``, fmt.Sprintf(`%.2f%% (%d of %d)`, rate, report.Phase.Failed, report.Phase.Queries))
+
+		case sloNoTransport:
+			transport := report.Phase.Verdicts[verdictTransport]
+			ok := transport == 0
+			correctnessFailed = correctnessFailed || !ok
+			row(ok, a.text, ``, fmt.Sprintf(`%d transport errors`, transport))
+
+		case sloMinRPS:
+			ok := report.Phase.RPS >= a.limit
+			performanceFailed = performanceFailed || !ok
+			row(ok, a.text, ``, fmt.Sprintf(`%.0f rps`, report.Phase.RPS))
+
+		case sloLatency:
+			matched := false
+			for _, route := range report.Routes {
+				if !strings.Contains(route.Route, a.route) {
+					continue
+				}
+				matched = true
+				actual := time.Duration(latencyMetric(&route.Latency, a.metric)) * time.Microsecond
+				ok := actual < a.maxDur
+				performanceFailed = performanceFailed || !ok
+				row(ok, a.text, route.Route, actual.String())
+			}
+			if !matched {
+				performanceFailed = true
+				row(false, a.text, ``, `no such route`)
+			}
+		}
+	}
+
+	return correctnessFailed, performanceFailed
+}
+
+// latencyMetric возвращает avg/p50/p90/p95/p99/max задержки в микросекундах
+func latencyMetric(latency *reportLatency, metric string) int64 {
+	switch metric {
+	case `avg`:
+		return latency.AvgUs
+	case `p50`:
+		return latency.P50Us
+	case `p90`:
+		return latency.P90Us
+	case `p95`:
+		return latency.P95Us
+	case `p99`:
+		return latency.P99Us
+	}
+	return latency.MaxUs
+}
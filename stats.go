@@ -0,0 +1,105 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// sortDurations сортирует длительности по возрастанию на месте
+func sortDurations(durs []time.Duration) {
+	sort.Slice(durs, func(i, j int) bool { return durs[i] < durs[j] })
+}
+
+// percentile возвращает p-й перцентиль (0..100) уже отсортированных длительностей
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted))*p/100+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	} else if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+var (
+	// latencyBucketsUs - верхние границы корзин гистограммы задержек в микросекундах (последняя корзина - все остальное)
+	latencyBucketsUs = []int64{50, 100, 250, 500, 1000, 2500, 5000, 10000, 25000, 50000, 100000, 250000, 500000, 1000000, 2000000}
+)
+
+// latencyHistogram раскладывает длительности по корзинам latencyBucketsUs; результат на одну корзину длиннее
+func latencyHistogram(durs []time.Duration) []int64 {
+	counts := make([]int64, len(latencyBucketsUs)+1)
+	for _, dur := range durs {
+		us := int64(dur / time.Microsecond)
+		idx := sort.Search(len(latencyBucketsUs), func(i int) bool { return us <= latencyBucketsUs[i] })
+		counts[idx]++
+	}
+	return counts
+}
+
+// latencySample берет до n равномерно расположенных значений отсортированных длительностей, в микросекундах
+func latencySample(sorted []time.Duration, n int) []int64 {
+	if len(sorted) < n {
+		n = len(sorted)
+	}
+	sample := make([]int64, 0, n)
+	for i := 0; i < n; i++ {
+		sample = append(sample, int64(sorted[i*len(sorted)/n]/time.Microsecond))
+	}
+	return sample
+}
+
+// mannWhitney - двусторонний U-тест Манна-Уитни в нормальном приближении с поправкой на совпадения.
+// Возвращает p-value и z: z > 0 значит, что значения b в целом больше значений a
+func mannWhitney(a, b []int64) (pValue, z float64) {
+	n1, n2 := float64(len(a)), float64(len(b))
+	if n1 == 0 || n2 == 0 {
+		return 1, 0
+	}
+
+	type item struct {
+		value int64
+		fromB bool
+	}
+	all := make([]item, 0, len(a)+len(b))
+	for _, v := range a {
+		all = append(all, item{v, false})
+	}
+	for _, v := range b {
+		all = append(all, item{v, true})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].value < all[j].value })
+
+	// ранги с усреднением для совпадающих значений
+	var rankSumB, ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].fromB {
+				rankSumB += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+
+	n := n1 + n2
+	u := rankSumB - n2*(n2+1)/2
+	mu := n1 * n2 / 2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return 1, 0
+	}
+
+	z = (u - mu) / sigma
+	return math.Erfc(math.Abs(z) / math.Sqrt2), z
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Посекундные ряды: rps, ошибки по классам и перцентили задержки по каждому маршруту и в сумме.
+// Секунда запроса считается от старта бенчмарка по времени отправки, поэтому всплески после пауз видны на своих местах
+
+const (
+	timeSeriesAll = `all`
+)
+
+type (
+	timeSeriesKey struct {
+		sec   int
+		route string
+	}
+
+	timeSeriesBucket struct {
+		queries  int64
+		verdicts map[string]int64
+		durs     []time.Duration
+	}
+
+	timeSeries struct {
+		mu      sync.Mutex
+		start   time.Time
+		buckets map[timeSeriesKey]*timeSeriesBucket
+	}
+
+	timeSeriesRow struct {
+		Sec      int              `json:"sec"`
+		Route    string           `json:"route"`
+		RPS      int64            `json:"rps"`
+		Verdicts map[string]int64 `json:"verdicts"`
+		P50Us    int64            `json:"p50_us"`
+		P90Us    int64            `json:"p90_us"`
+		P99Us    int64            `json:"p99_us"`
+		MaxUs    int64            `json:"max_us"`
+	}
+)
+
+func newTimeSeries(start time.Time) *timeSeries {
+	return &timeSeries{start: start, buckets: make(map[timeSeriesKey]*timeSeriesBucket)}
+}
+
+// add учитывает результат в секунде его отправки: по маршруту и в общем ряду
+func (ts *timeSeries) add(my map[timeSeriesKey]*timeSeriesBucket, route string, benchResult *BenchResult, verdict string) {
+	sec := int(benchResult.start.Sub(ts.start) / time.Second)
+	if sec < 0 {
+		sec = 0
+	}
+
+	for _, key := range []timeSeriesKey{{sec, route}, {sec, timeSeriesAll}} {
+		bucket, ok := my[key]
+		if !ok {
+			bucket = &timeSeriesBucket{verdicts: make(map[string]int64)}
+			my[key] = bucket
+		}
+		bucket.queries++
+		bucket.verdicts[verdict]++
+		bucket.durs = append(bucket.durs, benchResult.dur)
+	}
+}
+
+func (ts *timeSeries) merge(my map[timeSeriesKey]*timeSeriesBucket) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	for key, bucket := range my {
+		total, ok := ts.buckets[key]
+		if !ok {
+			ts.buckets[key] = bucket
+			continue
+		}
+		total.queries += bucket.queries
+		for verdict, count := range bucket.verdicts {
+			total.verdicts[verdict] += count
+		}
+		total.durs = append(total.durs, bucket.durs...)
+	}
+}
+
+// rows возвращает ряды по секундам; внутри секунды сначала общий ряд, затем маршруты по алфавиту
+func (ts *timeSeries) rows() []timeSeriesRow {
+	keys := make([]timeSeriesKey, 0, len(ts.buckets))
+	for key := range ts.buckets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].sec != keys[j].sec {
+			return keys[i].sec < keys[j].sec
+		}
+		if (keys[i].route == timeSeriesAll) != (keys[j].route == timeSeriesAll) {
+			return keys[i].route == timeSeriesAll
+		}
+		return keys[i].route < keys[j].route
+	})
+
+	rows := make([]timeSeriesRow, 0, len(keys))
+	for _, key := range keys {
+		bucket := ts.buckets[key]
+		latency := newReportLatency(bucket.durs)
+		rows = append(rows, timeSeriesRow{
+			Sec:      key.sec,
+			Route:    key.route,
+			RPS:      bucket.queries,
+			Verdicts: bucket.verdicts,
+			P50Us:    latency.P50Us,
+			P90Us:    latency.P90Us,
+			P99Us:    latency.P99Us,
+			MaxUs:    latency.MaxUs,
+		})
+	}
+	return rows
+}
+
+// write сохраняет ряды в CSV или, для файлов *.json, в JSON
+func (ts *timeSeries) write(fileName string) error {
+	rows := ts.rows()
+
+	fd, err := os.Create(fileName)
+	if err != nil {
+		return errors.Wrap(err, `os.Create`)
+	}
+
+	if err := writeTimeSeriesRows(fd, strings.HasSuffix(strings.ToLower(fileName), `.json`), rows); err != nil {
+		fd.Close()
+		return err
+	}
+	return errors.Wrap(fd.Close(), `fd.Close`)
+}
+
+func writeTimeSeriesRows(wr io.Writer, asJSON bool, rows []timeSeriesRow) error {
+	if asJSON {
+		enc := json.NewEncoder(wr)
+		enc.SetEscapeHTML(false)
+		return errors.Wrap(enc.Encode(rows), `json.Encode`)
+	}
+
+	w := csv.NewWriter(wr)
+	header := []string{`sec`, `route`, `rps`}
+	for _, verdict := range verdictClasses {
+		header = append(header, verdict)
+	}
+	header = append(header, `p50_us`, `p90_us`, `p99_us`, `max_us`)
+	w.Write(header)
+
+	itoa := func(v int64) string { return strconv.FormatInt(v, 10) }
+	for _, row := range rows {
+		record := []string{strconv.Itoa(row.Sec), row.Route, itoa(row.RPS)}
+		for _, verdict := range verdictClasses {
+			record = append(record, itoa(row.Verdicts[verdict]))
+		}
+		record = append(record, itoa(row.P50Us), itoa(row.P90Us), itoa(row.P99Us), itoa(row.MaxUs))
+		w.Write(record)
+	}
+
+	w.Flush()
+	return errors.Wrap(w.Error(), `csv.Write`)
+}
@@ -0,0 +1,52 @@
+package main
+
+// Итог проверки одного ответа. Классы ошибок нужны отчетам, логу запросов и метрикам
+const (
+	verdictOK        = `ok`
+	verdictStatus    = `status`
+	verdictBody      = `body`
+	verdictInvariant = `invariant`
+	verdictTransport = `transport`
+)
+
+var (
+	verdictClasses = []string{verdictOK, verdictStatus, verdictBody, verdictInvariant, verdictTransport}
+)
+
+// bulletVerdict сверяет полученный ответ с ожидаемым: статус, тело (если ждали 200), затем инварианты
+func bulletVerdict(bullet *Bullet, benchResult *BenchResult) (string, []invariantViolation) {
+	if (bullet.Response.Status != 0 || benchResult.status < 0) && benchResult.status != bullet.Response.Status {
+		if benchResult.status < 0 {
+			return verdictTransport, nil
+		}
+		return verdictStatus, nil
+	}
+
+	if bullet.Response.Status == 200 && !equalBulletBody(benchResult.body, &bullet.Response) {
+		return verdictBody, nil
+	}
+
+	if violations := checkBulletInvariants(bullet, benchResult); len(violations) > 0 {
+		return verdictInvariant, violations
+	}
+
+	return verdictOK, nil
+}
+
+// liveVerdict проверяет ответ сразу после запроса, если вердикт нужен потоковому логу или метрикам
+func liveVerdict(benchResult *BenchResult) {
+	if resultLog != nil || liveMetrics != nil {
+		benchResult.verdict, _ = bulletVerdict(bullets[benchResult.bulletIdx], benchResult)
+	}
+}
+
+// resultVerdict возвращает вердикт ответа, повторно используя посчитанный в воркере
+func resultVerdict(bullet *Bullet, benchResult *BenchResult) (string, []invariantViolation) {
+	switch benchResult.verdict {
+	case ``:
+		return bulletVerdict(bullet, benchResult)
+	case verdictInvariant:
+		return verdictInvariant, checkBulletInvariants(bullet, benchResult)
+	}
+	return benchResult.verdict, nil
+}
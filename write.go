@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Запись патронов и ответов в форматах, которые понимают loadDataRequests/loadDataResponses.
+// Размер в заголовке блока честный, поэтому файл читается и построчным разбором контеста, и phantom разбором
+
+var (
+	headerContentLength = []byte(`Content-Length`)
+)
+
+type (
+	ammoWriter struct {
+		ammo, answ *os.File
+	}
+)
+
+// createAmmoWriter создает prefix.ammo и prefix.answ (последний только если withAnswers)
+func createAmmoWriter(prefix string, withAnswers bool) (*ammoWriter, error) {
+	var (
+		aw  ammoWriter
+		err error
+	)
+
+	if aw.ammo, err = os.Create(prefix + `.ammo`); err != nil {
+		return nil, errors.Wrap(err, `os.Create`)
+	}
+	if withAnswers {
+		if aw.answ, err = os.Create(prefix + `.answ`); err != nil {
+			aw.ammo.Close()
+			return nil, errors.Wrap(err, `os.Create`)
+		}
+	}
+
+	return &aw, nil
+}
+
+func (aw *ammoWriter) write(request *Request, response *Response) error {
+	if err := writeAmmo(aw.ammo, request); err != nil {
+		return err
+	}
+	if aw.answ != nil {
+		return writeAnswer(aw.answ, request, response)
+	}
+	return nil
+}
+
+func (aw *ammoWriter) Close() error {
+	err := aw.ammo.Close()
+	if aw.answ != nil {
+		if errAnsw := aw.answ.Close(); err == nil {
+			err = errAnsw
+		}
+	}
+	return err
+}
+
+func writeAmmo(wr io.Writer, request *Request) error {
+	method := `GET`
+	if !request.IsGet {
+		method = `POST`
+	}
+
+	tag := request.Tag
+	if len(tag) == 0 {
+		tag = []byte(requestRoute(request))
+	}
+
+	body := singleLine(request.Body)
+
+	var raw bytes.Buffer
+	fmt.Fprintf(&raw, "%s %s HTTP/1.1\r\n", method, request.URI)
+	for _, header := range request.Headers {
+		if !bytes.EqualFold(header.Key, headerContentLength) {
+			fmt.Fprintf(&raw, "%s: %s\r\n", header.Key, header.Value)
+		}
+	}
+	if len(body) > 0 || !request.IsGet {
+		fmt.Fprintf(&raw, "%s: %d\r\n", headerContentLength, len(body))
+	}
+	raw.WriteString("\r\n")
+	raw.Write(body)
+
+	if _, err := fmt.Fprintf(wr, "%d %s\n", raw.Len(), tag); err != nil {
+		return errors.Wrap(err, `write ammo`)
+	}
+	if len(body) > 0 {
+		raw.WriteByte('\n')
+	}
+	_, err := wr.Write(raw.Bytes())
+	return errors.Wrap(err, `write ammo`)
+}
+
+func writeAnswer(wr io.Writer, request *Request, response *Response) error {
+	method := `GET`
+	if !request.IsGet {
+		method = `POST`
+	}
+
+	var err error
+	if body := singleLine(response.Body); len(body) > 0 {
+		_, err = fmt.Fprintf(wr, "%s\t%s\t%d\t%s\n", method, request.URI, response.Status, body)
+	} else {
+		_, err = fmt.Fprintf(wr, "%s\t%s\t%d\n", method, request.URI, response.Status)
+	}
+	return errors.Wrap(err, `write answer`)
+}
+
+// singleLine ужимает JSON до одной строки: и патроны контеста, и ответы читаются построчно
+func singleLine(body []byte) []byte {
+	if bytes.IndexByte(body, '\n') < 0 {
+		return body
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, body); err == nil {
+		return buf.Bytes()
+	}
+
+	return bytes.Replace(bytes.Replace(body, []byte{'\r'}, nil, -1), []byte{'\n'}, []byte{' '}, -1)
+}